@@ -0,0 +1,204 @@
+// Package batch runs -batch builds: it reads the list of versions, moves
+// them through a download and a build stage, shows the progress of both
+// and reports the outcome of each version.
+package batch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"buildREFramework/report"
+)
+
+// ReadFile reads the numeric versions listed in path, one per line. Blank
+// lines and anything after a # are ignored.
+func ReadFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(line, 10, 64); err != nil {
+			return nil, fmt.Errorf("%s line %d: %q is not a numeric version", path, i+1, line)
+		}
+		versions = append(versions, line)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s lists no versions", path)
+	}
+	return versions, nil
+}
+
+// Result is the outcome of one version of a batch.
+type Result struct {
+	Version  string
+	Archive  string
+	UpToDate bool
+	Err      error
+}
+
+// Run moves versions through a two-stage pipeline and returns a result per
+// version, in the order listed. fetch runs on a goroutine of its own, for
+// one version after another; build runs on the calling goroutine for each
+// value fetch returned, in the same order. The hand-off is unbuffered, so
+// at most one fetched version waits ahead of the build and each output
+// archive is still written by a single goroutine.
+func Run[V any](versions []string, fetch func(index int, num string) V, build func(V) Result) []Result {
+	fetched := make(chan V)
+	go func() {
+		defer close(fetched)
+		for i, num := range versions {
+			fetched <- fetch(i, num)
+		}
+	}()
+
+	results := make([]Result, 0, len(versions))
+	for v := range fetched {
+		results = append(results, build(v))
+	}
+	return results
+}
+
+// Count tallies results by outcome.
+func Count(results []Result) (built, upToDate, failed int) {
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+		case r.UpToDate:
+			upToDate++
+		default:
+			built++
+		}
+	}
+	return built, upToDate, failed
+}
+
+// WriteReport writes a line per result to w: the version, its outcome and
+// the archive or error.
+func WriteReport(w io.Writer, results []Result) {
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "  %-8s FAILED      %v\n", r.Version, r.Err)
+		case r.UpToDate:
+			fmt.Fprintf(w, "  %-8s up to date  %s\n", r.Version, r.Archive)
+		default:
+			fmt.Fprintf(w, "  %-8s built       %s\n", r.Version, r.Archive)
+		}
+	}
+}
+
+// Progress is the terminal view of a batch. Both pipeline stages report to
+// it: one line shows how many versions are finished and how far the current
+// download and build are, and status and log lines are printed above it.
+// As a report.Reporter it stands for the build stage, and Downloads for the
+// download stage. Quiet drops Status and the progress line but keeps Log.
+type Progress struct {
+	Total int
+	Quiet bool
+
+	mu                sync.Mutex
+	done              int
+	dlName, buildName string // what each stage is working on, "" when idle
+	dlFrac, buildFrac float64
+	line              string // progress line on screen without its newline
+}
+
+// Status prints msg unless p is quiet.
+func (p *Progress) Status(msg string) {
+	if !p.Quiet {
+		p.Log(msg)
+	}
+}
+
+// Log prints msg on its own line above the progress line.
+func (p *Progress) Log(msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLineLocked()
+	fmt.Println(msg)
+}
+
+// Progress records how far the build stage is.
+func (p *Progress) Progress(frac float64) {
+	p.update(func() { p.buildFrac = frac })
+}
+
+// downloads is the Reporter of the download stage: its progress goes on
+// the batch line in place of the build stage's.
+type downloads struct{ p *Progress }
+
+func (d downloads) Status(msg string) { d.p.Status(msg) }
+func (d downloads) Log(msg string)    { d.p.Log(msg) }
+
+// Progress records how far the download stage is.
+func (d downloads) Progress(frac float64) {
+	d.p.update(func() { d.p.dlFrac = frac })
+}
+
+// Downloads returns the Reporter for the download stage.
+func (p *Progress) Downloads() report.Reporter {
+	return downloads{p}
+}
+
+// StartDownload and StartBuild record what a stage is now working on; ""
+// marks it idle.
+func (p *Progress) StartDownload(name string) {
+	p.update(func() { p.dlName, p.dlFrac = name, 0 })
+}
+
+func (p *Progress) StartBuild(name string) {
+	p.update(func() { p.buildName, p.buildFrac = name, 0 })
+}
+
+// Finish counts one more version as done, whatever its outcome.
+func (p *Progress) Finish() {
+	p.update(func() { p.done++ })
+}
+
+// update applies f and redraws the progress line if its text changed.
+func (p *Progress) update(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f()
+	if p.Quiet {
+		return
+	}
+	line := fmt.Sprintf("==> Batch %d/%d done", p.done, p.Total)
+	if p.buildName != "" {
+		line += fmt.Sprintf(" | building %s %3d%%", p.buildName, int(min(max(p.buildFrac, 0), 1)*100))
+	}
+	if p.dlName != "" {
+		line += fmt.Sprintf(" | downloading %s %3d%%", p.dlName, int(min(max(p.dlFrac, 0), 1)*100))
+	}
+	if line != p.line {
+		fmt.Printf("\r%-*s", len(p.line), line) // pad over a longer previous line
+		p.line = line
+	}
+}
+
+// EndLine finishes the progress line so the next output starts on a fresh
+// one.
+func (p *Progress) EndLine() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLineLocked()
+}
+
+func (p *Progress) endLineLocked() {
+	if p.line != "" {
+		fmt.Println()
+		p.line = ""
+	}
+}
@@ -16,6 +16,12 @@ set -euo pipefail
 WIN_DL="/mnt/c/Users/Mike/Downloads"
 GOPATH_BIN="$(go env GOPATH)/bin"
 
+# Reported by -version / About, and stamped into each archive's _reframework_builder.json
+VERSION="$(git describe --tags --always --dirty 2>/dev/null || echo dev)"
+COMMIT="$(git rev-parse --short HEAD 2>/dev/null || true)"
+BUILD_TIME="$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+STAMP="-X main.builderVersion=$VERSION -X main.builderCommit=$COMMIT -X main.builderBuildTime=$BUILD_TIME"
+
 build_size() {
   local file="$1"
   echo "$(du -sh "$file" | cut -f1)"
@@ -27,7 +33,7 @@ build_cli() {
 
   local before
   GOOS=windows GOARCH=amd64 go build \
-    -ldflags="-s -w" \
+    -ldflags="-s -w $STAMP" \
     -o "$EXE" \
     buildREFrameworkWinCLI.go
   before=$(build_size "$EXE")
@@ -55,7 +61,7 @@ build_gui() {
     GOOS=windows \
     GOARCH=amd64 \
     go build \
-      -ldflags="-H windowsgui -s -w" \
+      -ldflags="-H windowsgui -s -w $STAMP" \
       -o "$EXE" \
       buildREFrameworkWinGUI.go
   before=$(build_size "$EXE")
@@ -76,7 +82,7 @@ build_linux() {
 
   local before
   go build \
-    -ldflags="-s -w" \
+    -ldflags="-s -w $STAMP" \
     -o "$BIN" \
     buildREFramework.go
   before=$(build_size "$BIN")
@@ -1,61 +1,571 @@
 package main
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"buildREFramework/batch"
+	"buildREFramework/cache"
+	"buildREFramework/etag"
+	"buildREFramework/install"
+	"buildREFramework/naming"
+	"buildREFramework/release"
+	"buildREFramework/repack"
+	"buildREFramework/report"
+	"buildREFramework/stamp"
+	"buildREFramework/termcolor"
+	"buildREFramework/termui"
+	"buildREFramework/workdir"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRepo    = "praydog/REFramework-nightly"
+	defaultProfile = "novr"
+	builderRepo    = "VonZippySays/REFrameworkBuilder-MHWilds-noVR"
+	zipName        = "MHWILDS.zip"
+	defaultGame    = "MHWILDS"
 )
 
+// Process exit codes, so scripts can tell failures apart.
 const (
-	repoAPI    = "https://api.github.com/repos/praydog/REFramework-nightly/releases"
-	cacheDir   = ".cache_github"
-	cacheBody  = cacheDir + "/releases.json"
-	cacheEtag  = cacheDir + "/etag"
-	zipName    = "MHWILDS.zip"
+	exitOK        = 0
+	exitUsage     = 2   // bad flags, env vars or config
+	exitNetwork   = 3   // GitHub API or download failed
+	exitBuild     = 4   // reading, writing or installing archives failed
+	exitVerify    = 5   // -verify found files the filters should have removed
+	exitDeadline  = 6   // -deadline ran out before the run finished
+	exitCancelled = 130 // user quit or interrupted (SIGINT)
 )
 
-type Release struct {
-	TagName     string    `json:"tag_name"`
-	PublishedAt time.Time `json:"published_at"`
+// printRawRelease prints rel as the API sent it, indented, for -debug-json.
+func printRawRelease(rel release.Release) {
+	var b bytes.Buffer
+	if json.Indent(&b, rel.Raw, "", "  ") != nil {
+		b.Write(rel.Raw)
+	}
+	fmt.Printf("==> Release JSON for %s as GitHub sent it:\n%s\n", rel.TagName, b.String())
 }
 
+// cfg holds the effective settings: config.json overlaid with env and flags.
+var cfg Config
+
 type ProgressReader struct {
 	io.Reader
 	Total   int64
 	Current int64
+	Rep     report.Reporter // gets the fraction done; nil reports nothing
+	mu      sync.Mutex      // guards Current across Part readers
 }
 
 func (pr *ProgressReader) Read(p []byte) (int, error) {
 	n, err := pr.Reader.Read(p)
+	pr.add(n)
+	return n, err
+}
+
+// Part wraps r, one of several ranges downloaded in parallel, so that its
+// bytes count toward pr's progress.
+func (pr *ProgressReader) Part(r io.Reader) io.Reader {
+	return &partReader{r: r, pr: pr}
+}
+
+type partReader struct {
+	r  io.Reader
+	pr *ProgressReader
+}
+
+func (p *partReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pr.add(n)
+	return n, err
+}
+
+// add counts n more bytes and reports the new fraction to Rep.
+func (pr *ProgressReader) add(n int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
 	pr.Current += int64(n)
-	if pr.Total > 0 {
-		fmt.Printf("\r==> Downloading %s... [%.2f%%]", zipName, float64(pr.Current)*100/float64(pr.Total))
+	if pr.Total > 0 && pr.Rep != nil {
+		pr.Rep.Progress(float64(pr.Current) / float64(pr.Total))
 	}
-	return n, err
+}
+
+// Verify reports a truncated download: fewer (or more) bytes read than the
+// server's Content-Length. Unknown lengths are not checked.
+func (pr *ProgressReader) Verify() error {
+	if pr.Total >= 0 && pr.Current != pr.Total {
+		return fmt.Errorf("download truncated: got %d of %d bytes", pr.Current, pr.Total)
+	}
+	return nil
 }
 
 func main() {
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		fail(exitUsage, "Error reading config: %v", err)
+	}
+
+	flag.StringVar(&cfg.OutputDir, "out", envOr("OUTPUT_DIR", cfg.OutputDir), "Output `dir` for built archives")
+	flag.StringVar(&cfg.Repo, "repo", envOr("REPO", cfg.Repo), "GitHub `owner/name` to fetch nightly releases from")
+	flag.StringVar(&cfg.AssetName, "asset", envOr("ASSET_NAME", cfg.AssetName), "Release asset `name` to download")
+	silentFlag := flag.Bool("silent", os.Getenv("SILENT") == "1", "Skip all prompts and pick the latest release")
+	inputZip := flag.String("input", os.Getenv("INPUT_ZIP"), "Re-filter an existing local `zip` instead of downloading")
+	inputDir := flag.String("input-dir", os.Getenv("INPUT_DIR"), "Repack an extracted REFramework `folder` instead of downloading")
+	dryRunFlag := flag.Bool("dry-run", os.Getenv("DRY_RUN") == "1", "Report what the filters would keep and remove without building")
+	checksumFlag := flag.Bool("checksum", os.Getenv("WRITE_CHECKSUM") == "1", "Write a sha256sum-style .sha256 file next to the archive")
+	pruneFlag := flag.String("prune", os.Getenv("KEEP_BUILDS"), "After building, keep only the `N` newest built archives")
+	diffFlag := flag.Bool("diff", false, "Compare the filtered file lists of two versions: -diff <numA> <numB>")
+	installFlag := flag.Bool("install", os.Getenv("INSTALL") == "1", "Extract the built archive into the game folder (overwritten files are backed up)")
+	gameDirFlag := flag.String("game-dir", os.Getenv("GAME_DIR"), "Game `folder` for -install (default: detect the Steam install)")
+	reproducibleFlag := flag.Bool("reproducible", os.Getenv("REPRODUCIBLE") == "1", "Fixed entry timestamps (SOURCE_DATE_EPOCH or 1980-01-01) so identical input gives an identical archive")
+	debugJSONFlag := flag.Bool("debug-json", os.Getenv("DEBUG_JSON") == "1", "Print the chosen release's JSON as the GitHub API sent it, for reporting schema changes")
+	deadlineFlag := flag.String("deadline", os.Getenv("BUILD_DEADLINE"), "Give the whole run at most `duration` (e.g. 5m): fetch, download, build and copy; then clean up and exit with code 6")
+	verboseFlag := flag.Bool("v", os.Getenv("VERBOSE") == "1", "Verbose: also print debug lines (URLs, HTTP status, cache hits, filtered files)")
+	jsonFlag := flag.Bool("json", false, "Print a JSON result (or {\"error\": ...}) on stdout; all other output goes to stderr")
+	sortFlag := flag.String("sort", "date", "Menu `order`: date (newest first), asc (oldest first) or version")
+	notesFlag := flag.String("notes", "", "Print the release notes for numeric version `num` and exit")
+	formatFlag := flag.String("format", "zip", "Output `format`: zip or tgz, or csv or json with -list")
+	keepFlag := flag.String("keep", os.Getenv("KEEP_PATTERNS"), "Comma-separated `patterns`: keep only matching entries instead of excluding")
+	filtersFlag := flag.String("filters", os.Getenv("FILTERS"), "Comma-separated exclude `patterns` that replace the default set")
+	excludeFlag := flag.String("exclude", os.Getenv("EXTRA_FILTERS"), "Comma-separated `patterns` to exclude on top of the default (or -filters or -profile) set")
+	profileFlag := flag.String("profile", envOr("PROFILE", defaultProfile), "Filter `profile`: novr, full or a name from Profiles in config.json")
+	onlyDirsFlag := flag.String("only-dirs", os.Getenv("ONLY_DIRS"), "Comma-separated top-level `names`: keep only entries under them (applied before the other filters)")
+	verifyFlag := flag.String("verify", "", "Check a built `archive` against the active filters and exit (non-zero if files leaked)")
+	limitFlag := flag.String("limit", os.Getenv("RATE_LIMIT"), "Cap the download speed at `KB/s` (0 = unlimited)")
+	mirrorFlag := flag.String("mirror", os.Getenv("MIRROR"), "Download base `url` to try first; <url>/<tag>/<asset> must serve the asset")
+	chunksFlag := flag.String("chunks", os.Getenv("DOWNLOAD_CHUNKS"), "Download in `N` parallel byte ranges when the server allows it (1-16, default 1)")
+	keepVRFlag := flag.Bool("keep-vr", os.Getenv("KEEP_VR") == "1", "Keep every entry, VR/XR included; the output name gets a _full suffix")
+	flag.BoolVar(&noninteractive, "noninteractive", noninteractive, "Never prompt (for CI); pick the release with -latest or -select")
+	flag.BoolVar(&quiet, "quiet", quiet, "Only print warnings, errors and the final summary: no menu, progress or file list")
+	flag.BoolVar(&force, "force", force, "Rebuild an existing archive without asking, even if it is up to date")
+	flag.BoolVar(&keepDownload, "keep-download", keepDownload, "Keep the downloaded asset in the output dir after a successful build too (a failed build always keeps it)")
+	flag.BoolVar(&verifyExisting, "verify-existing", verifyExisting, "Decompress every entry of an existing archive before offering to skip its rebuild (its entry list is always checked)")
+	flag.BoolVar(&noVerify, "no-verify", noVerify, "Don't re-read the built archive to check that every entry decompresses")
+	expectMinFlag := flag.String("expect-size-min", os.Getenv("EXPECT_SIZE_MIN"), "Warn if the built archive is smaller than `size` (bytes, or e.g. 20MB)")
+	expectMaxFlag := flag.String("expect-size-max", os.Getenv("EXPECT_SIZE_MAX"), "Warn if the built archive is larger than `size` (bytes, or e.g. 60MB)")
+	flag.BoolVar(&strict, "strict", strict, "Fail the build instead of warning when -expect-size-min or -expect-size-max isn't met, or when -asset-pattern matches several assets")
+	flag.StringVar(&nameTemplate, "name-template", nameTemplate, "Output file name `template`: {version} {tag} {num} {hash} {date} or {date:layout} {prefix} {variant}")
+	flag.BoolVar(&progressJSON, "progress-json", os.Getenv("PROGRESS_JSON") == "1", "Write progress to stderr as JSON lines ({\"phase\":\"download\",\"pct\":0.42}) instead of the progress line")
+	tuiFlag := flag.Bool("tui", os.Getenv("TUI") == "1", "Choose the release in a full-screen terminal menu with notes and size beside the list")
+	latestFlag := flag.Bool("latest", os.Getenv("LATEST") == "1", "Pick the newest release without asking")
+	selectFlag := flag.String("select", os.Getenv("SELECT"), "Pick the release with this numeric `version` or tag (or a unique part of one) without asking")
+	beforeFlag := flag.String("before", os.Getenv("BEFORE"), "Only offer releases published before `date` (YYYY-MM-DD, UTC)")
+	afterFlag := flag.String("after", os.Getenv("AFTER"), "Only offer releases published on or after `date` (YYYY-MM-DD, UTC)")
+	includePreFlag := flag.Bool("include-prereleases", os.Getenv("INCLUDE_PRERELEASES") == "1", "Also offer releases GitHub marks as prereleases")
+	batchFlag := flag.String("batch", os.Getenv("BATCH_FILE"), "Build every numeric version listed in `file` (one per line, # starts a comment) unattended, then report")
+	flag.StringVar(&commentOverride, "comment", os.Getenv("ZIP_COMMENT"), "Zip archive `comment` (default: what it was built from, plus the source zip's comment)")
+	prefixFlag := flag.String("prefix", envOrSet("ARCHIVE_PREFIX", archivePrefix), "Folder `path` every archive entry is placed under (empty for none)")
+	noPrefixFlag := flag.Bool("no-prefix", os.Getenv("NO_ARCHIVE_PREFIX") == "1", "Put the entries at the top level of the archive instead of under MHWILDS/ (same as -prefix \"\")")
+	assetPatternFlag := flag.String("asset-pattern", os.Getenv("ASSET_PATTERN"), "Pick each release's asset by `pattern` (re:<regexp>, or text the name contains) instead of -asset: the largest match, or an error with -strict if several match")
+	gameFlag := flag.String("game", envOr("GAME", defaultGame), "Game `name` to build: the release asset <name>.zip, placed under <name>/")
+	listFlag := flag.Bool("list", false, "List every release found (all of them, not just MAX_LIST) and exit")
+	exportFlag := flag.String("export", "", "With -list, write the releases to `file` as csv or json instead")
+	offlineFlag := flag.Bool("offline", os.Getenv("OFFLINE") == "1", "Use the cached release list instead of calling the GitHub API")
+	clearCacheFlag := flag.Bool("clear-cache", false, "Delete the GitHub cache folder and exit")
+	cacheInfoFlag := flag.Bool("cache-info", false, "Print the cache folder, ETag, fetch time and cached release count, then exit")
+	versionFlag := flag.Bool("version", false, "Print the builder's version, commit and Go version and exit")
+	flag.Parse()
+	if *versionFlag {
+		fmt.Println(versionString())
+		return
+	}
+	if *jsonFlag {
+		jsonOut = os.Stdout
+		os.Stdout = os.Stderr
+		if *dryRunFlag || *diffFlag || *notesFlag != "" || *verifyFlag != "" || *clearCacheFlag || *cacheInfoFlag || *listFlag {
+			fail(exitUsage, "Error: -json only reports builds; it can't be combined with -dry-run, -diff, -notes, -verify, -clear-cache, -cache-info or -list")
+		}
+	}
+	if *verboseFlag {
+		verbosity = levelDebug
+	} else if quiet {
+		verbosity = levelError
+	}
+	if len(commentOverride) > 65535 {
+		fail(exitUsage, "Error: -comment is %d bytes; a zip comment holds at most 65535", len(commentOverride))
+	}
+	if archivePrefix, err = parsePrefix(*prefixFlag); err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	if *noPrefixFlag {
+		if archivePrefix != "" && archivePrefix != defaultGame {
+			fail(exitUsage, "Error: -no-prefix and -prefix %s both set the archive folder; use one", archivePrefix)
+		}
+		archivePrefix = ""
+	}
+	if err := applyGame(*gameFlag); err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	if *assetPatternFlag != "" {
+		if assetPattern, err = parseAssetPattern(*assetPatternFlag); err != nil {
+			fail(exitUsage, "Error: %v", err)
+		}
+	}
+	dates, err := release.ParseDateRange("-after", *afterFlag, "-before", *beforeFlag)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	if *latestFlag && *selectFlag != "" {
+		fail(exitUsage, "Error: -latest and -select both pick a release; use one")
+	}
+	if *silentFlag {
+		noninteractive = true
+	}
+	if *tuiFlag && !noninteractive {
+		if termui.Available() {
+			tuiMode = true
+		} else {
+			fmt.Println("Note: -tui needs a terminal; using the plain prompt")
+		}
+	}
+	var batchVersions []string
+	if *batchFlag != "" {
+		if *selectFlag != "" || *latestFlag || !dates.IsZero() || *inputZip != "" || *inputDir != "" || *dryRunFlag || *diffFlag ||
+			*notesFlag != "" || *verifyFlag != "" || *listFlag || *installFlag || *pruneFlag != "" || *jsonFlag || progressJSON {
+			fail(exitUsage, "Error: -batch picks its own versions; it can't be combined with -select, -latest, -before, -after, -input, -input-dir, -dry-run, -diff, -notes, -verify, -list, -install, -prune, -json or -progress-json")
+		}
+		if batchVersions, err = batch.ReadFile(*batchFlag); err != nil {
+			fail(exitUsage, "Error: -batch: %v", err)
+		}
+		noninteractive = true
+	}
+	handleInterrupts()
+	if *deadlineFlag != "" {
+		d, err := time.ParseDuration(*deadlineFlag)
+		if err != nil || d <= 0 {
+			fail(exitUsage, "Error: -deadline / BUILD_DEADLINE must be a duration such as 90s or 5m, got %q", *deadlineFlag)
+		}
+		startDeadline(d)
+	}
+	if moved, err := initCache(); err != nil {
+		logf(levelError, "Warning: could not move %s to %s: %v", legacyCacheDir, cacheDir, err)
+	} else if moved {
+		fmt.Printf("==> Moved %s to %s\n", legacyCacheDir, cacheDir)
+	}
+	if *clearCacheFlag {
+		removed, err := clearCache()
+		if err != nil {
+			fail(exitBuild, "Error clearing cache: %v", err)
+		}
+		if removed > 0 {
+			fmt.Printf("==> Removed %d cached file(s) from %s\n", removed, cacheDir)
+		} else {
+			fmt.Printf("==> No cache at %s\n", cacheDir)
+		}
+		return
+	}
+	if *cacheInfoFlag {
+		if err := printCacheInfo(); err != nil {
+			fail(exitBuild, "Error reading cache: %v", err)
+		}
+		return
+	}
+	startUpdateCheck()
+	if os.Getenv("NO_TEMP_CLEANUP") != "1" {
+		if n, size := workdir.Sweep(time.Hour); n > 0 {
+			fmt.Printf("==> Removed %d stale temp dir(s), reclaimed %s\n", n, formatSize(size))
+		}
+	}
+
+	if *sortFlag != "date" && *sortFlag != "asc" && *sortFlag != "version" {
+		fail(exitUsage, "Error: -sort must be date, asc or version, got %q", *sortFlag)
+	}
+	if *listFlag {
+		// -format keeps its archive default unless set; -export's extension picks then
+		if *formatFlag == "zip" {
+			*formatFlag = "csv"
+			if strings.EqualFold(filepath.Ext(*exportFlag), ".json") {
+				*formatFlag = "json"
+			}
+		}
+		if *formatFlag != "csv" && *formatFlag != "json" {
+			fail(exitUsage, "Error: -list exports csv or json, got %q", *formatFlag)
+		}
+		if *inputZip != "" || *inputDir != "" {
+			fail(exitUsage, "Error: -list reads the GitHub release list; it can't be combined with -input or -input-dir")
+		}
+	} else if *exportFlag != "" {
+		fail(exitUsage, "Error: -export needs -list")
+	} else if *formatFlag != "zip" && *formatFlag != "tgz" {
+		fail(exitUsage, "Error: -format must be zip or tgz (csv or json with -list), got %q", *formatFlag)
+	}
+
+	if *reproducibleFlag {
+		t, err := reproducibleTime()
+		if err != nil {
+			fail(exitUsage, "Error: %v", err)
+		}
+		entryTime = t
+	}
+
+	gameDir := ""
+	if *installFlag {
+		if *formatFlag != "zip" {
+			fail(exitUsage, "Error: -install needs -format zip")
+		}
+		if game != defaultGame {
+			fail(exitUsage, "Error: -install only knows Monster Hunter Wilds; it can't be combined with -game")
+		}
+		gameDir = *gameDirFlag
+		if gameDir == "" {
+			var err error
+			if gameDir, err = install.FindGameDir(); err != nil {
+				fail(exitUsage, "Error: %v", err)
+			}
+		} else if !install.IsGameDir(gameDir) {
+			fail(exitUsage, "Error: %s not found in %s", install.GameExe, gameDir)
+		}
+	}
+
+	keepBuilds := 0
+	if *pruneFlag != "" {
+		n, err := strconv.Atoi(*pruneFlag)
+		if err != nil || n < 1 {
+			fail(exitUsage, "Error: -prune / KEEP_BUILDS must be a number >= 1, got %q", *pruneFlag)
+		}
+		keepBuilds = n
+	}
+	if *expectMinFlag != "" {
+		if expectMin, err = parseSize(*expectMinFlag); err != nil {
+			fail(exitUsage, "Error: -expect-size-min / EXPECT_SIZE_MIN: %v", err)
+		}
+	}
+	if *expectMaxFlag != "" {
+		if expectMax, err = parseSize(*expectMaxFlag); err != nil {
+			fail(exitUsage, "Error: -expect-size-max / EXPECT_SIZE_MAX: %v", err)
+		}
+	}
+	if expectMax > 0 && expectMin > expectMax {
+		fail(exitUsage, "Error: -expect-size-min (%s) is above -expect-size-max (%s)", formatSize(expectMin), formatSize(expectMax))
+	}
+	if err := nameScheme().Check(); err != nil {
+		fail(exitUsage, "Error: -name-template / NAME_TEMPLATE: %v", err)
+	}
+	if keepBuilds > 0 && nameTemplate != naming.DefaultTemplate && strings.Trim(nameScheme().Glob("zip"), "*") == ".zip" {
+		fail(exitUsage, "Error: -prune needs some fixed text in -name-template to recognise built archives by, got %q", nameTemplate)
+	}
+	if *limitFlag != "" {
+		n, err := strconv.Atoi(*limitFlag)
+		if err != nil || n < 0 {
+			fail(exitUsage, "Error: -limit / RATE_LIMIT must be a number of KB/s >= 0, got %q", *limitFlag)
+		}
+		rateLimit = n * 1024
+	}
+	if *chunksFlag != "" {
+		n, err := strconv.Atoi(*chunksFlag)
+		if err != nil || n < 1 || n > 16 {
+			fail(exitUsage, "Error: -chunks / DOWNLOAD_CHUNKS must be a number from 1 to 16, got %q", *chunksFlag)
+		}
+		downloadChunks = n
+	}
+	if v := os.Getenv("MIRRORS"); v != "" {
+		cfg.Mirrors = splitPatterns(v)
+	}
+	if *mirrorFlag != "" {
+		cfg.Mirrors = append([]string{*mirrorFlag}, cfg.Mirrors...)
+	}
+	for _, m := range cfg.Mirrors {
+		if !strings.HasPrefix(m, "https://") && !strings.HasPrefix(m, "http://") {
+			fail(exitUsage, "Error: mirror %q must be an http:// or https:// URL", m)
+		}
+	}
+
+	patterns, err := profileFilters(cfg, *profileFlag)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	if *profileFlag != defaultProfile {
+		if *keepFlag != "" || *keepVRFlag {
+			fail(exitUsage, "Error: -profile can't be combined with -keep or -keep-vr.")
+		}
+		variantSuffix = "_" + *profileFlag
+	}
+	keepOnly := false
+	if *keepFlag != "" {
+		patterns, keepOnly = splitPatterns(*keepFlag), true
+		if len(patterns) == 0 {
+			fail(exitUsage, "Error: -keep was given but contains no patterns.")
+		}
+	}
+	if *keepVRFlag {
+		if keepOnly {
+			fail(exitUsage, "Error: -keep-vr and -keep can't be combined.")
+		}
+		patterns, variantSuffix = nil, "_full"
+	}
+	if *filtersFlag != "" || *excludeFlag != "" {
+		if *keepFlag != "" || *keepVRFlag {
+			fail(exitUsage, "Error: -filters and -exclude can't be combined with -keep or -keep-vr.")
+		}
+		if *filtersFlag != "" && *profileFlag != defaultProfile {
+			fail(exitUsage, "Error: -filters replaces the -profile patterns; use one.")
+		}
+		if patterns, err = extendFilters(patterns, *filtersFlag, *excludeFlag); err != nil {
+			fail(exitUsage, "Error: %v", err)
+		}
+	}
+	filters, err := repack.NewFilterSet(patterns, keepOnly)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	if filters.OnlyDirs, err = parseOnlyDirs(*onlyDirsFlag); err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+	logf(levelDebug, "effective filters: %s", filters)
+
+	if *verifyFlag != "" {
+		problems, err := verifyArchive(*verifyFlag, filters)
+		if err != nil {
+			fail(exitBuild, "Error reading %s: %v", *verifyFlag, err)
+		}
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		if len(problems) > 0 {
+			fail(exitVerify, "%s: %d violation(s) of the current rules (%s)", *verifyFlag, len(problems), filters)
+		}
+		fmt.Printf("==> %s is clean (%s)\n", *verifyFlag, filters)
+		return
+	}
+
+	// Stop now on a folder that can't be written, not after the download
+	if !*listFlag && !*diffFlag && *notesFlag == "" && os.Getenv("SKIP_DOWNLOAD") != "1" {
+		local := *inputZip != "" || *inputDir != ""
+		if !local && batchVersions == nil {
+			if err := checkWritable("."); err != nil {
+				fail(exitBuild, "Error: %v. The download is saved in the working folder; run from a writable one.", err)
+			}
+		}
+		if !*dryRunFlag {
+			if err := checkWritable(cfg.OutputDir); err != nil {
+				fail(exitBuild, "Error: %v. Choose another output folder with -out or OUTPUT_DIR.", err)
+			}
+		}
+		if !local && !*offlineFlag {
+			if err := checkWritable(cacheDir); err != nil {
+				fail(exitBuild, "Error: %v. Point CACHE_DIR at a writable folder.", err)
+			}
+		}
+	}
+
+	// Repack a local folder: zip it up as it is, then carry on as -input
+	if *inputDir != "" {
+		if *inputZip != "" {
+			fail(exitUsage, "Error: -input and -input-dir both name the source; use one")
+		}
+		fi, err := os.Stat(*inputDir)
+		if err == nil && !fi.IsDir() {
+			err = fmt.Errorf("%s is not a folder", *inputDir)
+		}
+		if err != nil {
+			fail(exitUsage, "Error: -input-dir: %v", err)
+		}
+		abs, _ := filepath.Abs(*inputDir)
+		tmpDir, err := workdir.Create("dir")
+		if err != nil {
+			fail(exitBuild, "Error creating temp folder: %v", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		removeOnInterrupt(tmpDir)
+		defer keepOnInterrupt(tmpDir)
+		// Named and dated after the folder, so the output name and the
+		// archive comment come from it rather than the temp file
+		packed := filepath.Join(tmpDir, filepath.Base(abs)+".zip")
+		setPhase("packing " + *inputDir)
+		if err := repack.PackDir(downloadCtx, abs, packed, func(format string, args ...any) {
+			logf(levelError, "Warning: "+format, args...)
+		}); err != nil {
+			fail(exitBuild, "Error reading input folder: %v", err)
+		}
+		os.Chtimes(packed, fi.ModTime(), fi.ModTime())
+		*inputZip = packed
+	}
+
+	// Re-filter a local archive: no API fetch, no download
+	if *inputZip != "" && os.Getenv("SKIP_DOWNLOAD") != "1" {
+		if *dryRunFlag {
+			if err := dryRun(*inputZip, filters); err != nil {
+				fail(exitBuild, "Error reading input zip: %v", err)
+			}
+			return
+		}
+		version, finalZip, err := localOutputName(*inputZip, *formatFlag)
+		if err != nil {
+			fail(exitBuild, "Error reading input zip: %v", err)
+		}
+		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+			fail(exitBuild, "Error creating output dir: %v", err)
+		}
+		from := *inputZip
+		if *inputDir != "" {
+			from = *inputDir
+		}
+		fmt.Printf("==> Creating optimized archive from %s: %s\n", from, finalZip)
+		setPhase("building " + finalZip)
+		stats, err := transcode(downloadCtx, newReporter("transcode"), *inputZip, finalZip, *formatFlag, filters, newBuildMeta("", *inputZip, time.Time{}, filters))
+		if err != nil {
+			transcodeFailed(finalZip, err)
+		}
+		if *checksumFlag {
+			printChecksum(finalZip)
+		}
+		printSummary(finalZip, "", time.Time{})
+		if keepBuilds > 0 {
+			prune(keepBuilds, finalZip)
+		}
+		if gameDir != "" {
+			installToGame(finalZip, gameDir)
+		}
+		emitResult("", version, finalZip, stats)
+		progressDone(finalZip)
+		return
+	}
+
 	// 1. Fetching releases and allow selection like the shell script
-	fmt.Println("==> Fetching recent dev releases...")
+	fetchRep := newReporter("fetch")
+	fetchRep.Status("==> Fetching recent dev releases...")
+	setPhase("fetching the release list")
 	// Read env overrides
 	devPrefix := os.Getenv("DEV_PREFIX")
-	maxList := 20
+	maxList := cfg.MaxList
 	if v := os.Getenv("MAX_LIST"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			maxList = n
 		}
 	}
 	// If interactive terminal (and not silent), prompt for MAX_LIST
-	silent := os.Getenv("SILENT") == "1"
-	if !silent {
+	silent := *silentFlag
+	latest := silent || *latestFlag
+	if !noninteractive && !tuiMode && !*diffFlag && *notesFlag == "" && !*listFlag {
 		if fi, _ := os.Stdin.Stat(); (fi.Mode() & os.ModeCharDevice) != 0 {
 			fmt.Printf("How many releases to display? [%d]: ", maxList)
 			var input string
@@ -72,67 +582,114 @@ func main() {
 
 	// 1. Fetching releases with ETag caching
 	os.MkdirAll(cacheDir, 0755)
-	etag, _ := os.ReadFile(cacheEtag)
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, _ := http.NewRequest("GET", repoAPI+"?per_page=100", nil)
-	if sEtag := strings.TrimSpace(string(etag)); sEtag != "" {
-		req.Header.Set("If-None-Match", sEtag)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error fetching releases: %v\n", err)
-		os.Exit(1)
+	var releases []release.Release
+	unlockCache := func() {}
+	if !*offlineFlag {
+		unlockCache = lockCache()
+		if cacheReadOnly {
+			// Another instance is refreshing the list; the copy it had will do
+			if cached, err := githubCache.ReadReleases(); err == nil {
+				releases = cached
+			}
+		}
 	}
-	defer resp.Body.Close()
-
-	var releases []Release
-	if resp.StatusCode == http.StatusNotModified {
-		// Use cache
-		f, err := os.Open(cacheBody)
+	if *offlineFlag {
+		cached, err := githubCache.ReadReleases()
 		if err != nil {
-			fmt.Printf("Error opening cache: %v\n", err)
-			os.Exit(1)
-		}
-		defer f.Close()
-		if err := json.NewDecoder(f).Decode(&releases); err != nil {
-			fmt.Printf("Error parsing cached JSON: %v\n", err)
-			os.Exit(1)
-		}
-	} else if resp.StatusCode == http.StatusOK {
-		// Update cache while decoding
-		// Note: We need the raw bytes to write to cache, but we can decode simultaneously
-		// or just read all and then decode from buffer. Stream decoding from a TeeReader
-		// would be most efficient to cache and decode in one pass.
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("Error reading response: %v\n", err)
-			os.Exit(1)
-		}
-		if err := json.Unmarshal(data, &releases); err != nil {
-			fmt.Printf("Error decoding JSON: %v\n", err)
-			os.Exit(1)
+			fail(exitNetwork, "Error: -offline needs a cached release list: %v", err)
 		}
-		os.WriteFile(cacheBody, data, 0644)
-		if newEtag := resp.Header.Get("ETag"); newEtag != "" {
-			os.WriteFile(cacheEtag, []byte(newEtag), 0644)
+		releases = cached
+		logf(levelDebug, "offline, using %s", githubCache.Releases)
+	} else if releases != nil {
+		logf(levelDebug, "cache locked, using %s", githubCache.Releases)
+	} else if resp, err := requestReleases(fetchRep, githubCache.ReadETag()); err != nil {
+		// Out of retries; an old list beats no list
+		cached, cerr := githubCache.ReadReleases()
+		if cerr != nil || downloadCtx.Err() != nil {
+			fail(exitNetwork, "Error fetching releases: %v", err)
 		}
+		releases = cached
+		logf(levelError, "Warning: network unavailable (%v), using cached release list from %s", err, githubCache.FetchTime())
 	} else {
-		// Fail if no cache, or use old cache if available
-		if f, err := os.Open(cacheBody); err == nil {
-			defer f.Close()
-			json.NewDecoder(f).Decode(&releases)
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotModified {
+			cached, err := githubCache.ReadReleases()
+			if err == nil {
+				logf(levelDebug, "release list cache hit (%s)", githubCache.Releases)
+				if !cacheReadOnly {
+					now := time.Now()
+					os.Chtimes(githubCache.Releases, now, now) // the fetch time -cache-info reports
+				}
+				releases = cached
+			} else {
+				// The ETag still matches but the list it stands for is gone;
+				// drop it and fetch the full list again
+				logf(levelError, "Warning: release cache was corrupt (%v), refetching", err)
+				if !cacheReadOnly {
+					os.Remove(githubCache.ETag)
+				}
+				if resp, err = requestReleases(fetchRep, ""); err != nil {
+					fail(exitNetwork, "Error fetching releases: %v", err)
+				}
+				defer resp.Body.Close()
+			}
+		}
+
+		if resp.StatusCode == http.StatusNotModified {
+			// Served from the cache above, unless even the refetch was a 304
+			if releases == nil {
+				fail(exitNetwork, "Error: API returned 304 without a usable cache.")
+			}
+		} else if resp.StatusCode == http.StatusOK {
+			logf(levelDebug, "release list cache miss, refreshing %s", githubCache.Releases)
+			// Update cache while decoding
+			// Note: We need the raw bytes to write to cache, but we can decode simultaneously
+			// or just read all and then decode from buffer. Stream decoding from a TeeReader
+			// would be most efficient to cache and decode in one pass.
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				fail(exitNetwork, "Error reading response: %v", err)
+			}
+			if releases, err = release.Decode(data); err == nil {
+				saveReleases(data, resp.Header.Get("ETag"))
+			} else {
+				// Don't overwrite a good cache with it; fall back to that
+				cached, cerr := githubCache.ReadReleases()
+				if cerr != nil {
+					fail(exitNetwork, "Error: %v, and no usable cache is available (%v).", err, cerr)
+				}
+				releases = cached
+				logf(levelError, "Warning: %v. Using cached release data.", err)
+			}
+		} else if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+			reason := forbiddenReason(resp)
+			cached, err := githubCache.ReadReleases()
+			if err != nil {
+				fail(exitNetwork, "Error: %s, and no usable cache is available (%v).", reason, err)
+			}
+			releases = cached
+			logf(levelError, "Warning: %s. Using cached release data.", reason)
 		} else {
-			fmt.Printf("Error: API returned status %d and no cache available.\n", resp.StatusCode)
-			os.Exit(1)
+			// Fail if no cache, or use old cache if available
+			cached, err := githubCache.ReadReleases()
+			if err != nil {
+				fail(exitNetwork, "Error: API returned status %d and no usable cache is available (%v).", resp.StatusCode, err)
+			}
+			releases = cached
+			logf(levelError, "Warning: API returned status %d, using cached release list from %s", resp.StatusCode, githubCache.FetchTime())
 		}
 	}
+	unlockCache()
+	resolveAssets(releases)
 
 	var tag string
 	var pubDate time.Time
 	// Build map of numeric -> (published_at, tag) keeping most recent per numeric
-	numMap := make(map[string]Release)
+	numMap := make(map[string]release.Release)
 	re := regexp.MustCompile(`^nightly-(\d{4,})-([A-Za-z0-9]+)$`)
+	hiddenPre := 0
+	var otherNums []string // numeric versions DEV_PREFIX left out
 	for _, r := range releases {
 		m := re.FindStringSubmatch(r.TagName)
 		if len(m) == 0 {
@@ -140,6 +697,18 @@ func main() {
 		}
 		num := m[1]
 		if devPrefix != "" && !strings.HasPrefix(num, devPrefix) {
+			otherNums = append(otherNums, num)
+			continue
+		}
+		if !release.Listable(r, *includePreFlag) {
+			logf(levelDebug, "skipping %s (draft %v, prerelease %v, published %v)", r.TagName, r.Draft, r.Prerelease, !r.PublishedAt.IsZero())
+			if release.Listable(r, true) {
+				hiddenPre++
+			}
+			continue
+		}
+		if assetPattern != nil && len(assetMatches(r)) == 0 {
+			logf(levelDebug, "skipping %s (no asset matching %s)", r.TagName, assetPattern)
 			continue
 		}
 		cur, ok := numMap[num]
@@ -151,7 +720,7 @@ func main() {
 	// Create sorted list by publish date desc
 	type item struct {
 		Num string
-		Rel Release
+		Rel release.Release
 	}
 	items := make([]item, 0, len(numMap))
 	for k, v := range numMap {
@@ -159,203 +728,3018 @@ func main() {
 	}
 	sort.Slice(items, func(i, j int) bool { return items[i].Rel.PublishedAt.After(items[j].Rel.PublishedAt) })
 
-	if len(items) == 0 {
-		fmt.Println("Error: Could not find any nightly numeric releases.")
-		os.Exit(1)
+	if len(items) == 0 && hiddenPre > 0 {
+		fail(exitUsage, "Error: the only matching nightly releases are %d prerelease(s); use -include-prereleases to offer them", hiddenPre)
+	} else if len(items) == 0 && devPrefix != "" && len(otherNums) > 0 {
+		fail(exitUsage, "Error: %d releases fetched but none start with prefix %q — try a shorter prefix (available: %s)", len(releases), devPrefix, prefixExamples(otherNums))
+	} else if len(items) == 0 && devPrefix != "" {
+		fail(exitUsage, "Error: no nightly numeric release matches DEV_PREFIX %q", devPrefix)
+	} else if len(items) == 0 {
+		fail(exitNetwork, "Error: Could not find any nightly numeric releases.")
+	}
+
+	if *notesFlag != "" {
+		if err := printNotes(numMap, *notesFlag); err != nil {
+			fail(exitUsage, "Error: %v", err)
+		}
+		return
+	}
+
+	if *diffFlag {
+		if err := diffVersions(numMap, flag.Args(), filters); err != nil {
+			fail(exitBuild, "Error: %v", err)
+		}
+		return
+	}
+
+	if *listFlag {
+		rows := releaseRows(numMap, *sortFlag)
+		if *exportFlag == "" {
+			for _, r := range rows {
+				size := "size unknown"
+				if r.Size > 0 {
+					size = formatSize(uint64(r.Size))
+				}
+				fmt.Printf(" %s  (%s)  %s  %s\n", r.Version, r.Tag, r.PublishedAt.Format("2006-01-02 15:04:05"), size)
+			}
+			return
+		}
+		if err := exportReleases(rows, *exportFlag, *formatFlag); err != nil {
+			fail(exitBuild, "Error writing %s: %v", *exportFlag, err)
+		}
+		fmt.Printf("==> Wrote %d release(s) to %s\n", len(rows), *exportFlag)
+		return
+	}
+
+	if batchVersions != nil {
+		showUpdateNotice()
+		os.Exit(runBatch(numMap, batchVersions, *formatFlag, filters, *checksumFlag))
+	}
+
+	if !dates.IsZero() {
+		inRange := items[:0]
+		for _, it := range items {
+			if dates.Contains(it.Rel.PublishedAt) {
+				inRange = append(inRange, it)
+			}
+		}
+		if len(inRange) == 0 {
+			fail(exitUsage, "Error: none of the %d release(s) was published %s", len(items), dates)
+		}
+		items = inRange
 	}
 
 	// Print summary and menu (limit to maxList)
 	total := len(items)
-	fmt.Printf("Found %d numeric nightly version(s).\n", total)
-	fmt.Printf("Available numeric nightly versions (showing up to %d newest -> oldest):\n", maxList)
+	showUpdateNotice()
+	if dates.IsZero() {
+		fmt.Printf("Found %d numeric nightly version(s).\n", total)
+	} else {
+		fmt.Printf("Found %d numeric nightly version(s) published %s.\n", total, dates)
+	}
+	order := "newest -> oldest"
+	if !latest && *sortFlag == "asc" {
+		order = "oldest -> newest"
+	} else if !latest && *sortFlag == "version" {
+		order = "highest -> lowest version"
+	}
 	limit := maxList
 	if limit > total {
 		limit = total
 	}
-	for i := 0; i < limit; i++ {
-		it := items[i]
-		fmt.Printf(" %d. %s  (%s)  %s\n", i+1, it.Num, it.Rel.TagName, it.Rel.PublishedAt.Format("2006-01-02 15:04:05"))
+	// Re-order the displayed window; -latest and silent mode take the newest
+	if !latest {
+		menu := items[:limit]
+		sort.SliceStable(menu, func(i, j int) bool { return release.Less(menu[i].Rel, menu[j].Rel, *sortFlag) })
+	}
+	printMenu := func() {
+		if verbosity < levelInfo {
+			return
+		}
+		fmt.Printf("Available numeric nightly versions (showing up to %d newest, %s):\n", maxList, order)
+		for i := 0; i < limit; i++ {
+			it := items[i]
+			note := ""
+			if !hasAsset(it.Rel) {
+				note = "  [no " + cfg.AssetName + "]"
+			}
+			fmt.Printf(" %d. %s  (%s)  %s%s\n", i+1, it.Num, it.Rel.TagName, it.Rel.PublishedAt.Format("2006-01-02 15:04:05"), note)
+		}
+	}
+	if !tuiMode {
+		printMenu()
 	}
 
-	// Prompt selection if not in silent mode
+	// Prompt selection if not in silent mode. -select wins over silent mode;
+	// otherwise silent mode and -latest take items[0], the newest release by
+	// publish date left after DEV_PREFIX and -before/-after
+	newest := "the newest version"
+	if devPrefix != "" {
+		newest = fmt.Sprintf("the newest version with DEV_PREFIX %s", devPrefix)
+	}
 	var choice int
-	if silent {
+	rels := make([]release.Release, len(items))
+	for i, it := range items {
+		rels[i] = it.Rel
+	}
+	if *selectFlag != "" {
+		n, err := release.Pick(rels, 0, strings.TrimSpace(*selectFlag))
+		if err != nil {
+			fail(exitUsage, "Error: -select: %v", err)
+		}
+		choice = n
+		fmt.Printf("Selected version %s with -select\n", items[n-1].Num)
+	} else if latest {
 		choice = 1
-		fmt.Printf("Silent Mode: Automatically chose numeric version 1 (%s)\n", items[0].Num)
-	} else if maxList == 1 && limit >= 1 {
+		fmt.Printf("Automatically chose %s (%s)\n", newest, items[0].Num)
+	} else if limit == 1 {
+		// One candidate, whether from MAX_LIST=1 or filters; the
+		// existing-archive check below still asks unless -force
 		choice = 1
-		fmt.Printf("Display limit is 1: Automatically selecting latest version (%s)\n", items[0].Num)
+		fmt.Printf("Only one version to choose from: automatically selecting %s (%s)\n", newest, items[0].Num)
+	} else if noninteractive {
+		fail(exitUsage, "Error: nothing to choose the release with; -noninteractive needs -latest or -select")
 	} else {
-		fmt.Printf("Choose numeric version (1-%d) [1] (or 0 to exit): ", limit)
-		var input string
-		fmt.Scanln(&input)
-		if input == "" {
-			choice = 1
-		} else if input == "0" {
-			fmt.Println("Exiting as requested.")
-			os.Exit(2)
-		} else {
-			choice, _ = strconv.Atoi(input)
-			if choice < 1 || choice > limit {
-				choice = 1
+		if tuiMode {
+			n, err := tuiPick(rels[:limit], order)
+			if err != nil {
+				logf(levelError, "Warning: terminal UI failed (%v); using the plain prompt", err)
+				tuiMode = false
+				printMenu()
+			} else if n == 0 {
+				fmt.Println("Exiting as requested.")
+				os.Exit(exitCancelled)
+			}
+			choice = n
+		}
+		for choice == 0 {
+			fmt.Printf("Choose numeric version (1-%d), or type part of a version or date [1] (or 0 to exit): ", limit)
+			var input string
+			fmt.Scanln(&input)
+			input = strings.TrimSpace(input)
+			if input == "0" {
+				fmt.Println("Exiting as requested.")
+				os.Exit(exitCancelled)
+			}
+			n, err := release.Pick(rels, limit, input)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				continue
+			}
+			if _, err := releaseAsset(rels[n-1]); err != nil {
+				fmt.Printf("%v. Choose another version.\n", err)
+				continue
 			}
+			choice = n
 		}
 	}
+	if choice < 1 || choice > len(items) {
+		fail(exitUsage, "Error: no release to build (picked %d of %d)", choice, len(items))
+	}
 	sel := items[choice-1]
+	if *debugJSONFlag {
+		// Before the asset check: a missing asset is what it helps explain
+		printRawRelease(sel.Rel)
+	}
+	asset, err := releaseAsset(sel.Rel)
+	if err != nil {
+		fail(exitUsage, "Error: %v; pick another version", err)
+	}
+	cfg.AssetName = asset.Name // -asset-pattern's pick, for the messages below
 	tag = sel.Rel.TagName
 	pubDate = sel.Rel.PublishedAt
-
-	// Build version string for filename: nightly-<num>-<6chars>
-	m := re.FindStringSubmatch(tag)
-	version := tag
-	if len(m) == 3 {
-		shortHash := m[2]
-		if len(shortHash) > 6 {
-			shortHash = shortHash[:6]
-		}
-		// include the 'nightly-' prefix to match the shell script
-		version = fmt.Sprintf("nightly-%s-%s", m[1], shortHash)
+	version, finalZip, err := archivePath(sel.Rel, *formatFlag)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
 	}
-	finalZip := fmt.Sprintf("REFramework_%s_%s.zip", version, pubDate.Format("02Jan06"))
 
-	if _, err := os.Stat(finalZip); err == nil {
-		fmt.Printf("==> Archive %s already exists.\n", finalZip)
-		if silent {
-			fmt.Println("Silent Mode: Rebuilding existing archive.")
+	if _, err := os.Stat(finalZip); err == nil && !*dryRunFlag && existingUsable(finalZip) {
+		upToDate := sourceUnchanged(finalZip, sel.Rel, filters)
+		if upToDate {
+			fmt.Printf("==> Archive %s is up to date (source unchanged).\n", finalZip)
+		} else {
+			fmt.Printf("==> Archive %s already exists.\n", finalZip)
+		}
+		if force {
+			fmt.Println("-force: Rebuilding existing archive.")
+		} else if noninteractive && upToDate {
+			fmt.Println("Non-interactive: Skipping rebuild. Exiting.")
+			emitSkipped(tag, version, finalZip)
+			os.Exit(exitOK)
+		} else if noninteractive {
+			fmt.Println("Non-interactive: Rebuilding existing archive.")
 		} else {
 			fmt.Print("Do you want to rebuild it anyway? (y/N): ")
 			var confirm string
 			fmt.Scanln(&confirm)
 			if strings.ToLower(confirm) != "y" {
 				fmt.Println("==> Skipping rebuild. Exiting.")
-				os.Exit(0)
+				emitSkipped(tag, version, finalZip)
+				os.Exit(exitOK)
 			}
 		}
 	}
 
 	// 2. Downloading with progress
-	url := fmt.Sprintf("https://github.com/praydog/REFramework-nightly/releases/download/%s/MHWILDS.zip", tag)
 	fmt.Printf("==> Found tag: %s\n", tag)
 
 	// Support SKIP_DOWNLOAD env for testing
 	if os.Getenv("SKIP_DOWNLOAD") == "1" {
 		fmt.Println("SKIP_DOWNLOAD=1 - test mode")
-		fmt.Printf("Selected TAG: %s\nPublish date: %s\nWould create: %s\n", tag, pubDate.Format(time.RFC3339), finalZip)
+		fmt.Printf("Publish date: %s\n", pubDate.Format(time.RFC3339))
+		if err := printTestSummary(tag, version, finalZip, filters, *inputZip); err != nil {
+			fail(exitBuild, "Error reading input zip: %v", err)
+		}
 		return
 	}
 
-	out, err := os.Create(zipName)
-	if err != nil {
-		fmt.Printf("Error creating file: %v\n", err)
-		os.Exit(1)
-	}
-	defer out.Close()
-
-	resp, err = http.Get(url)
-	if err != nil {
-		fmt.Printf("Error downloading file: %v\n", err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	progressReader := &ProgressReader{
-		Reader: resp.Body,
-		Total:  resp.ContentLength,
+	removeOnInterrupt(zipName)
+	setPhase("downloading " + tag)
+	if err := downloadAsset(tag, zipName, newReporter("download")); err != nil {
+		os.Remove(zipName)
+		fail(exitNetwork, "Error downloading file: %v", err)
 	}
 
-	_, err = io.Copy(out, progressReader)
-	fmt.Println() // New line after progress
-	if err != nil {
-		fmt.Printf("Error saving file: %v\n", err)
-		os.Exit(1)
+	if *dryRunFlag {
+		err := dryRun(zipName, filters)
+		os.Remove(zipName)
+		if err != nil {
+			fail(exitBuild, "Error reading downloaded zip: %v", err)
+		}
+		return
 	}
 
 	// 3. Zip-to-Zip Transcoding (Streaming)
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		fail(exitBuild, "Error creating output dir: %v", err)
+	}
 	fmt.Printf("==> Creating optimized archive: %s\n", finalZip)
-	filters := []string{"RE", "vr", "xr", "VR", "XR", "DELETE", "OpenVR", "OpenXR"}
-	if err := transcodeZip(zipName, finalZip, filters); err != nil {
-		fmt.Printf("Error transcoding zip: %v\n", err)
-		os.Exit(1)
+	setPhase("building " + finalZip)
+	stats, err := transcode(downloadCtx, newReporter("transcode"), zipName, finalZip, *formatFlag, filters, newBuildMeta(tag, "", pubDate, filters))
+	if err != nil {
+		transcodeFailed(finalZip, fmt.Errorf("%w%s", err, rescueDownload(zipName, sel.Rel)))
 	}
+	writeSourceStamp(finalZip, sel.Rel, filters)
 
 	// Final Cleanup
+	if keepDownload {
+		if kept, err := saveDownload(zipName, sel.Rel); err != nil {
+			logf(levelError, "Warning: could not keep the download: %v", err)
+		} else {
+			fmt.Printf("==> Kept the download as %s\n", kept)
+		}
+	}
 	os.Remove(zipName)
 
-	statusLine := fmt.Sprintf("==> Finished! Created: %s", finalZip)
-	fmt.Printf("\033[1;34m==>\033[0m %s\n", statusLine[4:])
+	if *checksumFlag {
+		printChecksum(finalZip)
+	}
+
+	printSummary(finalZip, tag, pubDate)
+	if keepBuilds > 0 {
+		prune(keepBuilds, finalZip)
+	}
+	if gameDir != "" {
+		installToGame(finalZip, gameDir)
+	}
+	emitResult(tag, version, finalZip, stats)
+	progressDone(finalZip)
+}
+
+// printSummary prints the finished banner, what release tag was built from
+// (if any) and the archive contents.
+func printSummary(finalZip, tag string, published time.Time) {
+	fmt.Printf("%s Finished! Created: %s\n", termcolor.BoldBlue("==>"), finalZip)
+	if info := release.Info(tag, published); info != "" {
+		fmt.Println(info)
+	}
 
 	// 7. Show summary of archive contents
 	fmt.Printf("Archive Summary (%s):\n", finalZip)
-	zf, err := zip.OpenReader(finalZip)
+	entries, err := listArchive(finalZip)
 	if err == nil {
 		count := 0
-		for _, f := range zf.File {
-			fmt.Printf("  %s\n", f.Name)
-			if !f.FileInfo().IsDir() {
+		var uncompressed uint64
+		for _, e := range entries {
+			logf(levelInfo, "  %s", e.Name)
+			if !e.Dir {
 				count++
+				uncompressed += e.Size
 			}
 		}
-		zf.Close()
 		fmt.Printf("Total files: %d\n", count)
+		if fi, err := os.Stat(finalZip); err == nil {
+			fmt.Println(sizeSummary(uncompressed, uint64(fi.Size()), count))
+		}
 	}
 }
 
-func transcodeZip(src, dest string, filters []string) error {
-	sReader, err := zip.OpenReader(src)
+// printChecksum writes the .sha256 sidecar for finalZip and reports it.
+func printChecksum(finalZip string) {
+	digest, err := writeChecksum(finalZip)
 	if err != nil {
-		return err
+		fail(exitBuild, "Error writing checksum: %v", err)
+	}
+	fmt.Printf("==> SHA256: %s (%s.sha256)\n", digest, finalZip)
+}
+
+// prefixExamples lists a few of the numeric versions DEV_PREFIX left out,
+// highest first, for the error when it leaves out every release.
+func prefixExamples(nums []string) string {
+	sort.Slice(nums, func(i, j int) bool {
+		if len(nums[i]) != len(nums[j]) {
+			return len(nums[i]) > len(nums[j])
+		}
+		return nums[i] > nums[j]
+	})
+	if len(nums) > 5 {
+		nums = nums[:5]
+	}
+	return strings.Join(nums, ", ")
+}
+
+// hasAsset reports whether rel offers the configured asset for download.
+// Nightlies older than a game's support don't.
+func hasAsset(rel release.Release) bool {
+	_, err := releaseAsset(rel)
+	return err == nil
+}
+
+// assetPattern is set by -asset-pattern: each release's asset is then picked
+// by name from the ones it lists instead of being cfg.AssetName.
+var assetPattern *regexp.Regexp
+
+// releaseAssets maps a tag to the asset assetPattern picked in that release,
+// for the downloads that only know the tag. Filled by resolveAssets.
+var releaseAssets = map[string]string{}
+
+// parseAssetPattern reads -asset-pattern: re:<regexp>, or text the asset
+// name must contain.
+func parseAssetPattern(s string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(s, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("-asset-pattern %q: %v", s, err)
+		}
+		return re, nil
+	}
+	return regexp.MustCompile(regexp.QuoteMeta(s)), nil
+}
+
+// assetMatches returns the assets of rel whose names assetPattern matches.
+func assetMatches(rel release.Release) []release.Asset {
+	var matches []release.Asset
+	for _, a := range rel.Assets {
+		if assetPattern.MatchString(a.Name) {
+			matches = append(matches, a)
+		}
+	}
+	return matches
+}
+
+// releaseAsset returns the asset of rel to build: the one named
+// cfg.AssetName or, with -asset-pattern, the largest one that matches. With
+// -strict several matches are an error instead.
+func releaseAsset(rel release.Release) (release.Asset, error) {
+	if assetPattern == nil {
+		for _, a := range rel.Assets {
+			if a.Name == cfg.AssetName {
+				return a, nil
+			}
+		}
+		return release.Asset{}, errors.New(missingAsset(rel))
+	}
+	matches := assetMatches(rel)
+	if len(matches) == 0 {
+		return release.Asset{}, errors.New(missingAsset(rel))
+	}
+	if len(matches) > 1 && strict {
+		names := make([]string, len(matches))
+		for i, a := range matches {
+			names[i] = a.Name
+		}
+		return release.Asset{}, fmt.Errorf("%s has %d assets matching %s (%s); -strict needs exactly one", rel.TagName, len(matches), assetPattern, strings.Join(names, ", "))
+	}
+	best := matches[0]
+	for _, a := range matches[1:] {
+		if a.Size > best.Size {
+			best = a
+		}
+	}
+	return best, nil
+}
+
+// resolveAssets records the asset -asset-pattern picks in each of rels.
+func resolveAssets(rels []release.Release) {
+	if assetPattern == nil {
+		return
+	}
+	for _, r := range rels {
+		if a, err := releaseAsset(r); err == nil {
+			releaseAssets[r.TagName] = a.Name
+		}
+	}
+}
+
+// assetName is the name of the asset to download for tag.
+func assetName(tag string) string {
+	if name, ok := releaseAssets[tag]; ok {
+		return name
+	}
+	return cfg.AssetName
+}
+
+// applyGame switches the build to another game in the nightly releases:
+// <name>.zip is downloaded and its entries go under <name>/, unless the
+// asset or the prefix was set to something else explicitly.
+func applyGame(name string) error {
+	name = strings.TrimSuffix(name, ".zip")
+	if name == defaultGame {
+		return nil
+	}
+	if !gameNameRe.MatchString(name) {
+		return fmt.Errorf("-game must be an asset name such as RE4 or DMC5, got %q", name)
+	}
+	if cfg.AssetName == zipName {
+		cfg.AssetName = name + ".zip"
+	}
+	if archivePrefix == defaultGame {
+		archivePrefix = name
+	}
+	game, gameSuffix, sourceRootDir = name, "_"+name, name+"/"
+	return nil
+}
+
+// releaseGames returns the games rel has a zip for, sorted.
+func releaseGames(rel release.Release) []string {
+	var games []string
+	for _, a := range rel.Assets {
+		if name, ok := strings.CutSuffix(a.Name, ".zip"); ok {
+			games = append(games, name)
+		}
+	}
+	sort.Strings(games)
+	return games
+}
+
+// missingAsset explains that rel has no asset to build. When it has other
+// games' zips they are listed, which points out a mistyped -game.
+func missingAsset(rel release.Release) string {
+	if assetPattern != nil {
+		return fmt.Sprintf("%s has no asset matching %s", rel.TagName, assetPattern)
+	}
+	if games := releaseGames(rel); len(games) > 0 && game != defaultGame {
+		return fmt.Sprintf("%s has no %s to download (it has: %s)", rel.TagName, cfg.AssetName, strings.Join(games, ", "))
+	}
+	return fmt.Sprintf("%s has no %s to download (it predates it)", rel.TagName, cfg.AssetName)
+}
+
+// newSourceStamp describes building rel's configured asset with filters. It
+// returns false if the release lists no such asset.
+func newSourceStamp(rel release.Release, filters repack.FilterSet) (stamp.Stamp, bool) {
+	a, err := releaseAsset(rel)
+	if err != nil {
+		return stamp.Stamp{}, false
+	}
+	return stamp.Stamp{
+		Tag:       rel.TagName,
+		Asset:     a.Name,
+		Size:      a.Size,
+		Digest:    a.Digest,
+		UpdatedAt: a.UpdatedAt,
+		Filters:   filters.String(),
+
+		Prefix:     archivePrefix,
+		Comment:    commentOverride,
+		EntryTime:  entryTime,
+		NoMetadata: os.Getenv("NO_METADATA") == "1",
+	}, true
+}
+
+// sourceUnchanged reports whether archive's .source.json says it was built
+// from the same asset (by digest, size and upload time) with the same filters
+// and output options.
+func sourceUnchanged(archive string, rel release.Release, filters repack.FilterSet) bool {
+	want, ok := newSourceStamp(rel, filters)
+	if !ok {
+		return false
+	}
+	return stamp.Unchanged(archive, want)
+}
+
+// writeSourceStamp saves archive's .source.json. Failures are only logged:
+// without a stamp the next run simply rebuilds.
+func writeSourceStamp(archive string, rel release.Release, filters repack.FilterSet) {
+	s, ok := newSourceStamp(rel, filters)
+	if !ok {
+		return
+	}
+	if err := stamp.Write(archive, s); err != nil {
+		logf(levelDebug, "writing source stamp: %v", err)
+	}
+}
+
+// writeChecksum computes the SHA256 of path and writes a sibling
+// <path>.sha256 in sha256sum format. It returns the hex digest.
+func writeChecksum(path string) (string, error) {
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	line := fmt.Sprintf("%s  %s\n", digest, filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(line), 0644); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// installToGame extracts finalZip into gameDir and reports what was written and
+// backed up.
+func installToGame(finalZip, gameDir string) {
+	fmt.Printf("==> Installing into %s\n", gameDir)
+	setPhase("installing into " + gameDir)
+	written, backedUp, backupDir, err := install.Archive(finalZip, gameDir, prefixed(""), metaName())
+	if err != nil {
+		fail(exitBuild, "Error installing into game folder: %v", err)
+	}
+	fmt.Printf("==> Installed %d file(s)\n", len(written))
+	if len(backedUp) > 0 {
+		fmt.Printf("==> Backed up %d overwritten file(s) to %s:\n", len(backedUp), backupDir)
+		for _, p := range backedUp {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+}
+
+// fileSHA256 returns the hex SHA256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// prune removes all but the newest keep archives and reports what went.
+func prune(keep int, finalZip string) {
+	removed, err := nameScheme().Prune(filepath.Dir(finalZip), keep, finalZip)
+	for _, p := range removed {
+		fmt.Printf("==> Pruned old archive: %s\n", p)
+	}
+	if err != nil {
+		fail(exitBuild, "Error pruning archives: %v", err)
+	}
+}
+
+// tuiPick shows rels in the -tui menu screen, with each release's date,
+// asset size and notes beside the list. It returns the 1-based choice, or 0
+// if the user quit.
+func tuiPick(rels []release.Release, order string) (int, error) {
+	items := make([]termui.Item, len(rels))
+	for i, r := range rels {
+		size := "no " + cfg.AssetName
+		a, aerr := releaseAsset(r)
+		if aerr == nil {
+			size = formatSize(uint64(a.Size)) + " (" + a.Name + ")"
+		}
+		detail := []string{
+			"Tag:       " + r.TagName,
+			"Published: " + r.PublishedAt.Format("2006-01-02 15:04 UTC"),
+			"Size:      " + size,
+			"",
+		}
+		if notes := strings.TrimSpace(r.Body); notes != "" {
+			detail = append(detail, strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n")...)
+		} else {
+			detail = append(detail, "(no release notes)")
+		}
+		items[i] = termui.Item{
+			Label:  fmt.Sprintf("%s  %s", r.TagName, r.PublishedAt.Format("2006-01-02")),
+			Detail: detail,
+		}
+		if aerr != nil {
+			items[i].Disabled = aerr.Error() + ". Choose another version."
+		}
+	}
+	n, err := termui.Select(fmt.Sprintf("REFramework nightly versions (%s)", order), items, 0)
+	return n + 1, err
+}
+
+// releaseRow is one release in a -list export.
+type releaseRow struct {
+	Version     string    `json:"version"`
+	Tag         string    `json:"tag"`
+	PublishedAt time.Time `json:"publishedAt"`
+	Size        int64     `json:"size,omitempty"`
+}
+
+// releaseRows lists every release in numMap in sortMode order, with the size
+// of the configured asset when the release lists it.
+func releaseRows(numMap map[string]release.Release, sortMode string) []releaseRow {
+	nums := make([]string, 0, len(numMap))
+	for n := range numMap {
+		nums = append(nums, n)
+	}
+	sort.Slice(nums, func(i, j int) bool { return release.Less(numMap[nums[i]], numMap[nums[j]], sortMode) })
+	rows := make([]releaseRow, 0, len(nums))
+	for _, n := range nums {
+		rel := numMap[n]
+		row := releaseRow{Version: n, Tag: rel.TagName, PublishedAt: rel.PublishedAt}
+		if a, err := releaseAsset(rel); err == nil {
+			row.Size = a.Size
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// exportReleases writes rows to path as "csv" or "json".
+func exportReleases(rows []releaseRow, path, format string) error {
+	var buf bytes.Buffer
+	if format == "json" {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			return err
+		}
+	} else {
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"version", "tag", "published", "size"})
+		for _, r := range rows {
+			size := ""
+			if r.Size > 0 {
+				size = strconv.FormatInt(r.Size, 10)
+			}
+			w.Write([]string{r.Version, r.Tag, r.PublishedAt.Format(time.RFC3339), size})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// printNotes prints the release notes of numeric version num.
+func printNotes(numMap map[string]release.Release, num string) error {
+	rel, ok := numMap[num]
+	if !ok {
+		return fmt.Errorf("version %s not found", num)
+	}
+	fmt.Printf("==> %s (%s)\n\n", rel.TagName, rel.PublishedAt.Format("2006-01-02 15:04 UTC"))
+	if strings.TrimSpace(rel.Body) == "" {
+		fmt.Println("(no release notes)")
+		return nil
+	}
+	fmt.Println(strings.TrimSpace(rel.Body))
+	return nil
+}
+
+// diffVersions downloads (or reuses cached copies of) the archives for two
+// numeric versions and prints the entries added, removed and changed (by
+// CRC32) between their filtered file sets.
+func diffVersions(numMap map[string]release.Release, args []string, filters repack.FilterSet) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: -diff <numA> <numB>")
+	}
+	var lists [2]map[string]uint32
+	for i, num := range args {
+		rel, ok := numMap[num]
+		if !ok {
+			return fmt.Errorf("version %s not found in the release list", num)
+		}
+		path, err := fetchAsset(rel.TagName, newReporter("download"))
+		if err != nil {
+			return fmt.Errorf("download %s: %w", rel.TagName, err)
+		}
+		if lists[i], err = listEntries(path, filters); err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+
+	var added, removed, changed []string
+	for name, crc := range lists[1] {
+		if oldCRC, ok := lists[0][name]; !ok {
+			added = append(added, name)
+		} else if oldCRC != crc {
+			changed = append(changed, name)
+		}
+	}
+	for name := range lists[0] {
+		if _, ok := lists[1][name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	fmt.Printf("==> Diff %s -> %s (%s)\n", args[0], args[1], filters)
+	for _, g := range []struct {
+		label string
+		names []string
+	}{{"Added", added}, {"Removed", removed}, {"Changed", changed}} {
+		sort.Strings(g.names)
+		fmt.Printf("%s (%d):\n", g.label, len(g.names))
+		for _, n := range g.names {
+			fmt.Printf("  %s\n", n)
+		}
+	}
+	return nil
+}
+
+// archivePath returns the short version string of rel's tag and the path of
+// the archive built from it in the output dir, named by nameTemplate.
+func archivePath(rel release.Release, format string) (version, finalZip string, err error) {
+	nf := naming.ReleaseFields(rel.TagName, rel.PublishedAt)
+	name, err := nameScheme().Name(nf)
+	if err != nil {
+		return "", "", err
+	}
+	return nf.Version, filepath.Join(cfg.OutputDir, naming.WithFormat(name, format)), nil
+}
+
+// nameTemplate names built archives (-name-template); see naming.Scheme.Name.
+var nameTemplate = envOr("NAME_TEMPLATE", naming.DefaultTemplate)
+
+// nameScheme is how this run names its archives: nameTemplate with the
+// archive prefix and variant suffix it is run with.
+func nameScheme() naming.Scheme {
+	return naming.Scheme{Template: nameTemplate, Prefix: archivePrefix, Variant: gameSuffix + variantSuffix}
+}
+
+// runBatch builds each of versions without prompting, carrying on past
+// failures, and prints a report. It returns exitOK if every version was
+// built (or already up to date) and exitBuild if any failed.
+//
+// Versions go through a two-stage pipeline: while one is transcoded, the
+// next is downloaded into its own temp dir. The hand-off is unbuffered, so
+// at most one download waits ahead of the build and each output archive is
+// still written by a single goroutine.
+func runBatch(numMap map[string]release.Release, versions []string, format string, filters repack.FilterSet, checksum bool) int {
+	prog := &batch.Progress{Total: len(versions), Quiet: verbosity < levelInfo}
+	fetch := func(i int, num string) *batchVersion {
+		prog.Log(fmt.Sprintf("%s [%d/%d] Version %s", termcolor.BoldBlue("==>"), i+1, len(versions), num))
+		return fetchVersion(prog, numMap, num, format, filters)
+	}
+	build := func(v *batchVersion) batch.Result {
+		r := batch.Result{Version: v.num, Archive: v.finalZip, UpToDate: v.upToDate, Err: v.err}
+		if r.Err == nil && !r.UpToDate {
+			r.Err = buildFetched(prog, v, format, filters, checksum)
+		}
+		if r.Err != nil {
+			prog.Log(fmt.Sprintf("Error: %v", r.Err))
+		}
+		prog.Finish()
+		return r
+	}
+	results := batch.Run(versions, fetch, build)
+	prog.EndLine()
+
+	built, upToDate, failed := batch.Count(results)
+	fmt.Printf("%s Batch finished: %d built, %d up to date, %d failed\n", termcolor.BoldBlue("==>"), built, upToDate, failed)
+	batch.WriteReport(os.Stdout, results)
+	if failed > 0 {
+		return exitBuild
+	}
+	return exitOK
+}
+
+// batchVersion is one version of a -batch run on its way through the
+// pipeline: fetchVersion resolves and downloads it, buildFetched builds it.
+type batchVersion struct {
+	num      string // numeric version as listed there
+	rel      release.Release
+	finalZip string
+	src      string // the downloaded asset, inside tmpDir
+	tmpDir   string // "" if nothing was downloaded
+	upToDate bool
+	err      error
+}
+
+// fetchVersion is the download stage of runBatch for numeric version num.
+// An archive already built from the same source is reported as up to date
+// and not downloaded. Each download gets its own temp dir, so it can't
+// collide with the build of the previous version.
+func fetchVersion(prog *batch.Progress, numMap map[string]release.Release, num, format string, filters repack.FilterSet) *batchVersion {
+	v := &batchVersion{num: num}
+	rel, ok := numMap[num]
+	if !ok {
+		v.err = fmt.Errorf("version %s not found in the release list", num)
+		return v
+	}
+	if _, v.err = releaseAsset(rel); v.err != nil {
+		return v
+	}
+	v.rel = rel
+	if _, v.finalZip, v.err = archivePath(rel, format); v.err != nil {
+		return v
+	}
+	if _, err := os.Stat(v.finalZip); err == nil && !force && sourceUnchanged(v.finalZip, rel, filters) {
+		if err := checkExisting(v.finalZip, verifyExisting); err != nil {
+			prog.Log(fmt.Sprintf("Warning: the existing %s is damaged (%v); rebuilding it.", v.finalZip, err))
+		} else {
+			prog.Status(fmt.Sprintf("==> Archive %s is up to date (source unchanged).", v.finalZip))
+			v.upToDate = true
+			return v
+		}
+	}
+
+	tmpDir, err := workdir.Create("batch")
+	if err != nil {
+		v.err = fmt.Errorf("create temp dir: %w", err)
+		return v
+	}
+	removeOnInterrupt(tmpDir)
+	prog.Status(fmt.Sprintf("==> Found tag: %s", rel.TagName))
+	prog.StartDownload(num)
+	v.src = filepath.Join(tmpDir, zipName)
+	setPhase("downloading " + rel.TagName)
+	err = downloadAsset(rel.TagName, v.src, prog.Downloads())
+	prog.StartDownload("")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		keepOnInterrupt(tmpDir)
+		v.err = fmt.Errorf("download %s: %w", rel.TagName, err)
+		return v
+	}
+	v.tmpDir = tmpDir
+	return v
+}
+
+// buildFetched is the build stage of runBatch: it transcodes the download
+// of v into its archive and removes the download.
+func buildFetched(prog *batch.Progress, v *batchVersion, format string, filters repack.FilterSet, checksum bool) error {
+	defer keepOnInterrupt(v.tmpDir)
+	defer os.RemoveAll(v.tmpDir)
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("create output dir: %w", err)
+	}
+	prog.Status(fmt.Sprintf("==> Creating optimized archive: %s", v.finalZip))
+	setPhase("building " + v.finalZip)
+	prog.StartBuild(v.num)
+	defer prog.StartBuild("")
+	if _, err := transcode(downloadCtx, prog, v.src, v.finalZip, format, filters, newBuildMeta(v.rel.TagName, "", v.rel.PublishedAt, filters)); err != nil {
+		err = fmt.Errorf("%w%s", err, rescueDownload(v.src, v.rel))
+		if _, statErr := os.Stat(v.finalZip); statErr == nil {
+			return fmt.Errorf("transcode: %w (the previous archive was preserved)", err)
+		}
+		return fmt.Errorf("transcode: %w", err)
+	}
+	writeSourceStamp(v.finalZip, v.rel, filters)
+	if keepDownload {
+		if kept, err := saveDownload(v.src, v.rel); err != nil {
+			prog.Log(fmt.Sprintf("Warning: could not keep the download of %s: %v", v.num, err))
+		} else {
+			prog.Status(fmt.Sprintf("==> Kept the download as %s", kept))
+		}
+	}
+	if checksum {
+		digest, err := writeChecksum(v.finalZip)
+		if err != nil {
+			return fmt.Errorf("write checksum: %w", err)
+		}
+		prog.Status(fmt.Sprintf("==> SHA256: %s (%s.sha256)", digest, v.finalZip))
+	}
+	return nil
+}
+
+// fetchAsset downloads the MHWILDS.zip asset for tag into the cache dir,
+// reusing an earlier download when present, and reports to rep. It returns
+// the local path.
+func fetchAsset(tag string, rep report.Reporter) (string, error) {
+	path := filepath.Join(cacheDir, tag+"_"+assetName(tag))
+	if _, err := os.Stat(path); err == nil {
+		rep.Status("==> Using cached " + path)
+		return path, nil
+	}
+
+	logf(levelDebug, "cache miss for %s, downloading", path)
+	// A name of its own, so another instance fetching the same tag can't
+	// write into it; the rename publishes whichever finishes
+	f, err := os.CreateTemp(cacheDir, filepath.Base(path)+".*.part")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	tmp := f.Name()
+	removeOnInterrupt(tmp)
+	defer keepOnInterrupt(tmp)
+	if err := downloadAsset(tag, tmp, rep); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// downloadChunks is how many byte ranges a download is split into and
+// fetched in parallel (-chunks); 1 downloads in a single stream.
+var downloadChunks = 1
+
+// minChunkSize keeps small files from being split into tiny ranges.
+const minChunkSize = 1 << 20
+
+// downloadAsset downloads the configured asset for tag to dst, trying each
+// source from assetURLs in turn until one succeeds. Progress and the
+// switches to another source go to rep.
+func downloadAsset(tag, dst string, rep report.Reporter) error {
+	var err error
+	for i, url := range assetURLs(tag) {
+		if i > 0 {
+			rep.Log(fmt.Sprintf("Warning: download failed (%v); trying %s", err, url))
+		}
+		if err = downloadURL(url, dst, rep); err == nil || downloadCtx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// downloadURL downloads url to dst, in parallel byte ranges when
+// downloadChunks asks for it and the server supports them, otherwise in a
+// single stream, reporting its progress to rep.
+func downloadURL(url, dst string, rep report.Reporter) error {
+	if downloadChunks > 1 {
+		size, ranges, err := probeRanges(url)
+		switch {
+		case err != nil:
+			logf(levelDebug, "HEAD %s: %v", url, err)
+		case ranges && size >= int64(downloadChunks)*minChunkSize:
+			return downloadRanges(url, dst, size, rep)
+		default:
+			logf(levelDebug, "%s: no byte ranges (or too small to split), downloading in one stream", url)
+		}
+	}
+
+	resp, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	logf(levelDebug, "GET %s: %s", url, resp.Status)
+	if final := resp.Request.URL.String(); final != url {
+		logf(levelDebug, "final URL: %s", final)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, url)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	pr := &ProgressReader{Reader: throttle(resp.Body), Total: resp.ContentLength, Rep: rep}
+	_, err = io.Copy(out, pr)
+	report.EndLine(rep)
+	if closeErr := out.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = pr.Verify()
+	}
+	return err
+}
+
+// probeRanges asks for url's size and whether it can be fetched in byte
+// ranges (Accept-Ranges: bytes).
+func probeRanges(url string) (size int64, ranges bool, err error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "HEAD", url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return resp.ContentLength, resp.ContentLength > 0 && resp.Header.Get("Accept-Ranges") == "bytes", nil
+}
+
+// downloadRanges fetches url into dst as downloadChunks parallel byte
+// ranges, each written at its own offset. One shared ProgressReader counts
+// the bytes of all of them.
+func downloadRanges(url, dst string, size int64, rep report.Reporter) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+	logf(levelDebug, "GET %s in %d ranges", url, downloadChunks)
+
+	ctx, cancel := context.WithCancel(downloadCtx)
+	defer cancel()
+	pr := &ProgressReader{Total: size, Rep: rep}
+	chunk := (size + int64(downloadChunks) - 1) / int64(downloadChunks)
+	errs := make(chan error, downloadChunks)
+	parts := 0
+	for start := int64(0); start < size; start += chunk {
+		end := min(start+chunk, size) - 1
+		parts++
+		go func() { errs <- fetchRange(ctx, url, out, start, end, pr) }()
+	}
+	for range parts {
+		if err2 := <-errs; err2 != nil && err == nil {
+			err = err2
+			cancel() // stop the other ranges
+		}
+	}
+	report.EndLine(rep)
+	if err == nil {
+		err = pr.Verify()
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// fetchRange downloads bytes start..end (inclusive) of url into out at
+// offset start.
+func fetchRange(ctx context.Context, url string, out *os.File, start, end int64, pr *ProgressReader) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range %d-%d: HTTP %s", start, end, resp.Status)
+	}
+	n, err := io.Copy(io.NewOffsetWriter(out, start), pr.Part(throttle(resp.Body)))
+	if err == nil && n != end-start+1 {
+		err = fmt.Errorf("range %d-%d: got %d bytes", start, end, n)
+	}
+	return err
+}
+
+// listEntries maps each file kept by the filters to its CRC32.
+func listEntries(src string, filters repack.FilterSet) (map[string]uint32, error) {
+	r, err := openZip(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	entries := make(map[string]uint32)
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		name := strings.TrimPrefix(f.Name, root)
+		if drop, _ := filters.Match(name); f.FileInfo().IsDir() || drop {
+			continue
+		}
+		entries[name] = f.CRC32
+	}
+	return entries, nil
+}
+
+// localOutputName derives the output name for a local source archive and
+// returns it with the version it was named for. The version (and date, for
+// previously built archives) comes from a nightly tag in the file name;
+// otherwise the modtime is used.
+func localOutputName(src, format string) (version, finalZip string, err error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return "", "", err
+	}
+	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	nf := naming.LocalFields(base, fi.ModTime())
+	name, err := nameScheme().Name(nf)
+	if err != nil {
+		return "", "", err
+	}
+	finalZip = filepath.Join(cfg.OutputDir, naming.WithFormat(name, format))
+	absSrc, _ := filepath.Abs(src)
+	absDst, _ := filepath.Abs(finalZip)
+	if absSrc == absDst {
+		return "", "", fmt.Errorf("output %s would overwrite the input", finalZip)
+	}
+	return nf.Version, finalZip, nil
+}
+
+// ioBufSize is the buffer on both ends of an archive copy, so large entries
+// move in a few big reads and writes instead of many small syscalls.
+const ioBufSize = 1 << 20
+
+// transcodeZip writes the filtered copy of the zip at src to dest, with the
+// builder's metadata entry and comment. It wraps repack.Zip.
+func transcodeZip(ctx context.Context, rep report.Reporter, src, dest string, filters repack.FilterSet, meta *buildMeta) (repack.Stats, error) {
+	sReader, err := openZip(src)
+	if err != nil {
+		return repack.Stats{}, err
+	}
+	defer sReader.Close()
+
+	dFile, err := os.Create(dest)
+	if err != nil {
+		return repack.Stats{}, err
+	}
+	defer dFile.Close()
+
+	opts := repackOptions(rep, zipComment(src, sReader.Comment, meta), meta)
+	stats, err := repack.Zip(ctx, &sReader.Reader, dFile, filters.Keep(sourceRoot(sReader.File)), opts)
+	if err != nil {
+		return stats, err
+	}
+	return stats, dFile.Close()
+}
+
+// repackOptions are the repack options of a build: the -prefix folder, the
+// -reproducible entry time, and the metadata entry for meta if it is set.
+func repackOptions(rep report.Reporter, comment string, meta *buildMeta) repack.Options {
+	opts := repack.Options{
+		Prefix:     archivePrefix,
+		SourceRoot: sourceRootDir,
+		EntryTime:  entryTime,
+		Comment:    comment,
+		Reporter:   rep,
+		Debugf:     func(format string, args ...any) { logf(levelDebug, format, args...) },
+	}
+	if meta != nil {
+		opts.MetaName = metaFile
+		opts.MetaData = func(stats repack.Stats) ([]byte, error) { return metaJSON(meta, stats) }
+	}
+	return opts
+}
+
+// entryTime, when set by -reproducible, replaces the modification time of
+// every archive entry.
+var entryTime time.Time
+
+// entryModTime returns t, or entryTime in reproducible mode.
+func entryModTime(t time.Time) time.Time {
+	if !entryTime.IsZero() {
+		return entryTime
+	}
+	return t
+}
+
+// commentOverride, set by -comment, replaces the generated zip comment.
+var commentOverride string
+
+// zipComment is the comment of an output zip: -comment if set, otherwise a
+// line saying what the archive was built from, followed by the source zip's
+// own comment unless the build is reproducible.
+func zipComment(src, srcComment string, meta *buildMeta) string {
+	if commentOverride != "" {
+		return commentOverride
+	}
+	from := filepath.Base(src)
+	if meta != nil && meta.SourceTag != "" {
+		from = meta.SourceTag
+	}
+	c := fmt.Sprintf("Built by REFramework Builder %s from %s on %s", builderVersion, from, entryModTime(time.Now()).UTC().Format("2006-01-02"))
+	if srcComment != "" && entryTime.IsZero() {
+		c += "\n" + srcComment
+	}
+	return c
+}
+
+// reproducibleTime is SOURCE_DATE_EPOCH if set, otherwise 1980-01-01 UTC
+// (the earliest time a zip header can hold).
+func reproducibleTime() (time.Time, error) {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", v)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// transcodeTarGz mirrors transcodeZip but writes a gzip-compressed tarball,
+// keeping the archive prefix and the source file modes.
+func transcodeTarGz(ctx context.Context, rep report.Reporter, src, dest string, filters repack.FilterSet, meta *buildMeta) (repack.Stats, error) {
+	sReader, err := openZip(src)
+	if err != nil {
+		return repack.Stats{}, fmt.Errorf("open source: %w", err)
 	}
 	defer sReader.Close()
 
-	dFile, err := os.Create(dest)
+	dFile, err := os.Create(dest)
+	if err != nil {
+		return repack.Stats{}, fmt.Errorf("create dest: %w", err)
+	}
+	defer dFile.Close()
+
+	stats, err := repack.TarGz(ctx, &sReader.Reader, dFile, filters.Keep(sourceRoot(sReader.File)), repackOptions(rep, "", meta))
+	if err != nil {
+		return stats, err
+	}
+	return stats, dFile.Close()
+}
+
+// transcode writes dest in the requested output format ("zip" or "tgz"),
+// reporting its progress to rep. Cancelling ctx stops it between entries
+// and removes the partial output.
+// Unless noVerify is set, the result is read back with testArchive before
+// it replaces dest.
+func transcode(ctx context.Context, rep report.Reporter, src, dest, format string, filters repack.FilterSet, meta *buildMeta) (repack.Stats, error) {
+	reportTopLevel(src, filters)
+	transcoding.Add(1)
+	defer transcoding.Add(-1)
+
+	// Build under a temporary name and rename over dest only once complete,
+	// so a failed rebuild leaves the previous archive intact
+	tmp := dest + ".partial"
+	removeOnInterrupt(tmp)
+	defer keepOnInterrupt(tmp)
+	var stats repack.Stats
+	var err error
+	if format == "tgz" {
+		stats, err = transcodeTarGz(ctx, rep, src, tmp, filters, meta)
+	} else {
+		stats, err = transcodeZip(ctx, rep, src, tmp, filters, meta)
+	}
+	if err == nil && !noVerify {
+		// Catch a truncated or corrupt write (a full disk, say) before it
+		// replaces the previous archive
+		logf(levelDebug, "verifying %s", tmp)
+		if verr := testArchive(ctx, tmp, format); verr != nil {
+			err = fmt.Errorf("built archive failed verification: %w", verr)
+		}
+	}
+	if err == nil && (expectMin > 0 || expectMax > 0) {
+		var fi os.FileInfo
+		if fi, err = os.Stat(tmp); err == nil {
+			err = checkSize(uint64(fi.Size()))
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return stats, err
+}
+
+// expectMin and expectMax bound the size of a built archive
+// (-expect-size-min, -expect-size-max); zero means no bound. With strict set
+// an archive outside them fails the build, otherwise it is only a warning.
+var (
+	expectMin, expectMax uint64
+	strict               = os.Getenv("STRICT") == "1"
+)
+
+// checkSize compares the size of a built archive with the expected band. A
+// size far off usually means the filters removed everything or nothing, or
+// the wrong asset was downloaded.
+func checkSize(size uint64) error {
+	var problem string
+	switch {
+	case expectMin > 0 && size < expectMin:
+		problem = fmt.Sprintf("archive is %s (%d bytes), below the expected minimum of %s", formatSize(size), size, formatSize(expectMin))
+	case expectMax > 0 && size > expectMax:
+		problem = fmt.Sprintf("archive is %s (%d bytes), above the expected maximum of %s", formatSize(size), size, formatSize(expectMax))
+	default:
+		logf(levelDebug, "archive is %d bytes, within the expected size", size)
+		return nil
+	}
+	if strict {
+		return errors.New(problem)
+	}
+	logf(levelError, "Warning: %s; check the filters and the source", problem)
+	return nil
+}
+
+// transcodeFailed exits after a failed build, saying so when an earlier
+// archive of the same name survived it.
+func transcodeFailed(finalZip string, err error) {
+	if _, statErr := os.Stat(finalZip); statErr == nil {
+		fail(exitBuild, "Error transcoding zip: %v\nThe previous archive %s was preserved.", err, finalZip)
+	}
+	fail(exitBuild, "Error transcoding zip: %v", err)
+}
+
+// saveDownload moves the downloaded asset src of rel into the output dir as
+// <tag>_<date>_<asset>, a name -input turns back into the usual archive
+// name, and returns its path.
+func saveDownload(src string, rel release.Release) (string, error) {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return "", err
+	}
+	name := rel.TagName + "_" + rel.PublishedAt.Format("02Jan06") + "_" + assetName(rel.TagName)
+	dst := filepath.Join(cfg.OutputDir, name)
+	if os.Rename(src, dst) == nil {
+		return dst, nil
+	}
+	// The temp dir is often on another volume; copy through a .part file
+	tmp := dst + ".part"
+	err := copyFile(src, tmp)
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return dst, nil
+}
+
+// rescueDownload keeps the download after a failed build, so it can be
+// looked at or rebuilt from without fetching it again, and returns a note
+// for the error message saying where it went. Nothing is kept after an
+// interrupt.
+func rescueDownload(src string, rel release.Release) string {
+	if downloadCtx.Err() != nil {
+		return ""
+	}
+	kept, err := saveDownload(src, rel)
+	if err != nil {
+		return fmt.Sprintf("\nThe download could not be kept: %v", err)
+	}
+	return fmt.Sprintf("\nThe download was kept as %s; rebuild from it with -input", kept)
+}
+
+// variantSuffix is appended to output names that aren't the usual stripped
+// build: "_full" with -keep-vr.
+var variantSuffix string
+
+// game is the nightly asset being built (-game), and gameSuffix what goes
+// before variantSuffix in output names: "_<game>" for any game but the
+// default, so builds of different games don't share a name.
+var (
+	game       = defaultGame
+	gameSuffix string
+)
+
+// gameNameRe matches a -game value: an asset name without its extension.
+var gameNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// sourceRootDir is the folder some source zips already wrap everything in:
+// the game's name.
+var sourceRootDir = defaultGame + "/"
+
+// archivePrefix is the folder every output entry is placed under (-prefix).
+// Empty puts the entries at the top level of the archive.
+var archivePrefix = "MHWILDS"
+
+// prefixed returns rel placed under archivePrefix.
+func prefixed(rel string) string {
+	if archivePrefix == "" {
+		return rel
+	}
+	return archivePrefix + "/" + rel
+}
+
+// parsePrefix validates a -prefix value: a relative slash-separated folder
+// path, or empty for none.
+func parsePrefix(s string) (string, error) {
+	p := strings.Trim(s, "/")
+	if p == "" {
+		return "", nil
+	}
+	if strings.Contains(p, `\`) {
+		return "", fmt.Errorf("-prefix must use forward slashes, got %q", s)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("-prefix must be a plain folder path, got %q", s)
+		}
+	}
+	return p, nil
+}
+
+// openZip opens a source zip with its entry names normalized by
+// repack.NormalizeNames.
+func openZip(path string) (*zip.ReadCloser, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	repack.NormalizeNames(r.File)
+	return r, nil
+}
+
+// sourceRoot returns sourceRootDir if every entry of a source zip is already
+// under it, so it can be stripped instead of being prefixed a second time
+// (MHWILDS/MHWILDS/...). Otherwise it returns "".
+func sourceRoot(files []*zip.File) string {
+	return repack.SourceRoot(files, sourceRootDir)
+}
+
+// archiveEntry is one entry of a built zip or tar.gz archive.
+type archiveEntry struct {
+	Name string
+	Size uint64
+	Dir  bool
+}
+
+// listArchive returns the entries of a built archive in stored order.
+func listArchive(path string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	if !strings.HasSuffix(path, ".tar.gz") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			entries = append(entries, archiveEntry{f.Name, f.UncompressedSize64, f.FileInfo().IsDir()})
+		}
+		return entries, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{hdr.Name, uint64(hdr.Size), hdr.Typeflag == tar.TypeDir})
+	}
+}
+
+// Config holds user preferences from config.json. Settings given through
+// env vars or flags override these values for a single run.
+type Config struct {
+	MaxList   int      `json:"MaxList,omitempty"`
+	OutputDir string   `json:"OutputDir,omitempty"`
+	Filters   []string `json:"Filters,omitempty"`
+	Repo      string   `json:"Repo,omitempty"`
+	AssetName string   `json:"AssetName,omitempty"`
+
+	// Mirrors are download base URLs tried in order before GitHub
+	Mirrors []string `json:"Mirrors,omitempty"`
+
+	// Profiles are extra named exclude lists, picked with -profile
+	Profiles map[string][]string `json:"Profiles,omitempty"`
+
+	// UpdateRepo is where the startup update check looks for new builders
+	UpdateRepo string `json:"UpdateRepo,omitempty"`
+}
+
+// legacyCacheDir is where releases and downloads were cached before the
+// cache moved to the user cache directory.
+const legacyCacheDir = ".cache_github"
+
+// The GitHub cache: the release list, its ETag and downloaded assets. Set by
+// initCache.
+var (
+	cacheDir    string
+	githubCache cache.Files
+)
+
+// initCache points the GitHub cache at CACHE_DIR, or at
+// reframework-builder/github under the user cache directory (which follows
+// XDG_CACHE_HOME on Linux). A .cache_github left in the working directory by
+// older versions is moved there while the new folder doesn't exist yet.
+func initCache() (moved bool, err error) {
+	cacheDir = os.Getenv("CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = legacyCacheDir
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "reframework-builder", "github")
+		}
+	}
+	githubCache = cache.In(cacheDir)
+
+	if fi, err := os.Stat(legacyCacheDir); err != nil || !fi.IsDir() {
+		return false, nil
+	}
+	if _, err := os.Stat(cacheDir); err == nil {
+		return false, nil // already migrated, or CACHE_DIR is the old folder
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(legacyCacheDir, cacheDir); err == nil {
+		return true, nil
+	}
+	// Rename fails across volumes: copy the files, then drop the old folder
+	entries, err := os.ReadDir(legacyCacheDir)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(legacyCacheDir, e.Name()), filepath.Join(cacheDir, e.Name())); err != nil {
+			return false, err
+		}
+	}
+	return true, os.RemoveAll(legacyCacheDir)
+}
+
+// checkWritable makes sure a file can be created in dir, creating dir if
+// needed, so a read-only folder stops the run before the download rather
+// than at the end of it.
+func checkWritable(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".write-test-*"); err == nil {
+			f.Close()
+			return os.Remove(f.Name())
+		}
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err // the folder is named below
+	}
+	if abs, aerr := filepath.Abs(dir); aerr == nil {
+		dir = abs
+	}
+	return fmt.Errorf("can't write to %s: %w", dir, err)
+}
+
+// copyFile copies src to dst through ioBufSize buffers.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriterSize(out, ioBufSize)
+	_, err = io.Copy(w, bufio.NewReaderSize(in, ioBufSize))
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// printCacheInfo describes the GitHub cache without touching the network.
+// The fetch time is the modtime of the release list, which a 304 refreshes.
+func printCacheInfo() error {
+	fmt.Printf("Cache folder: %s\n", cacheDir)
+	if etag := githubCache.ReadETag(); etag != "" {
+		fmt.Printf("ETag:         %s\n", etag)
+	} else {
+		fmt.Println("ETag:         none")
+	}
+	if fi, err := os.Stat(githubCache.Releases); err == nil {
+		data, err := os.ReadFile(githubCache.Releases)
+		if err != nil {
+			return err
+		}
+		var releases []release.Release
+		if err := json.Unmarshal(data, &releases); err != nil {
+			return fmt.Errorf("parse %s: %w", githubCache.Releases, err)
+		}
+		fmt.Printf("Fetched:      %s\n", fi.ModTime().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Releases:     %d\n", len(releases))
+	} else if os.IsNotExist(err) {
+		fmt.Println("Releases:     not cached")
+	} else {
+		return err
+	}
+
+	downloads, _ := filepath.Glob(filepath.Join(cacheDir, "*_"+cfg.AssetName))
+	var size uint64
+	for _, d := range downloads {
+		if fi, err := os.Stat(d); err == nil {
+			size += uint64(fi.Size())
+		}
+	}
+	fmt.Printf("Downloads:    %d (%s)\n", len(downloads), formatSize(size))
+	return nil
+}
+
+// clearCache deletes what the builder keeps in the cache folder: the release
+// list, its ETag, the lock, downloaded assets and the meta/ folder older GUIs
+// left. Anything else is left alone, so a CACHE_DIR shared with other files (the
+// output dir, Downloads) loses none of them; the folder itself goes only if
+// that leaves it empty. It returns how many entries were removed.
+func clearCache() (removed int, err error) {
+	for _, p := range cacheFiles() {
+		if _, err := os.Lstat(p); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	os.Remove(cacheDir) // fails unless empty
+	return removed, nil
+}
+
+// cacheFiles lists the paths the builder may have written to cacheDir.
+// Downloads are named <tag>_<asset>, so only those of releases in the
+// cached list are included (with their .part leftovers): a looser glob such
+// as *_RE4.zip would also match built archives.
+func cacheFiles() []string {
+	paths := []string{githubCache.Releases, githubCache.ETag, filepath.Join(cacheDir, ".lock"), filepath.Join(cacheDir, "meta")}
+	globs := []string{"." + filepath.Base(githubCache.Releases) + ".*.tmp", "." + filepath.Base(githubCache.ETag) + ".*.tmp"}
+	if releases, err := githubCache.ReadReleases(); err == nil {
+		for _, r := range releases {
+			for _, a := range r.Assets {
+				name := r.TagName + "_" + a.Name
+				if name == filepath.Base(name) {
+					paths = append(paths, filepath.Join(cacheDir, name))
+					globs = append(globs, name+".*.part")
+				}
+			}
+		}
+	}
+	for _, g := range globs {
+		matches, _ := filepath.Glob(filepath.Join(cacheDir, g))
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// configPath returns ~/.config/reframework-builder/config.json (or the
+// platform equivalent).
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "reframework-builder", "config.json"), nil
+}
+
+// loadConfig reads config.json and fills unset fields with the built-in
+// defaults. A missing config file is not an error.
+func loadConfig() (Config, error) {
+	var c Config
+	if path, err := configPath(); err == nil {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err := json.Unmarshal(data, &c); err != nil {
+				return c, fmt.Errorf("parse %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return c, err
+		}
+	}
+
+	if c.MaxList <= 0 {
+		c.MaxList = 20
+	}
+	if c.OutputDir == "" {
+		c.OutputDir = "."
+	}
+	if c.Filters == nil {
+		c.Filters = []string{"RE", "vr", "xr", "VR", "XR", "DELETE", "OpenVR", "OpenXR"}
+	}
+	if c.Repo == "" {
+		c.Repo = defaultRepo
+	}
+	if c.AssetName == "" {
+		c.AssetName = zipName
+	}
+	if c.UpdateRepo == "" {
+		c.UpdateRepo = builderRepo
+	}
+	return c, nil
+}
+
+// filterProfiles returns the named exclude lists: the built-in "novr" (the
+// Filters list) and "full" (nothing removed), plus any Profiles from
+// config.json, which may also override the built-in ones.
+func filterProfiles(c Config) map[string][]string {
+	profiles := map[string][]string{defaultProfile: c.Filters, "full": {}}
+	for name, patterns := range c.Profiles {
+		profiles[name] = patterns
+	}
+	return profiles
+}
+
+// profileNames returns the profile names in c, sorted.
+func profileNames(c Config) []string {
+	var names []string
+	for name := range filterProfiles(c) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileFilters returns the exclude list of the named profile.
+func profileFilters(c Config, name string) ([]string, error) {
+	if patterns, ok := filterProfiles(c)[name]; ok {
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("unknown filter profile %q (available: %s)", name, strings.Join(profileNames(c), ", "))
+}
+
+// envOr returns the value of the environment variable key, or def if unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envOrSet is envOr for values where an empty string is meaningful: def is
+// used only when key isn't set at all.
+func envOrSet(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// assetURL is the download URL of the configured asset for a release tag.
+func assetURL(tag string) string {
+	return fmt.Sprintf("https://github.com/%s/releases/download/%s/%s", cfg.Repo, tag, assetName(tag))
+}
+
+// assetURLs lists the sources to download the asset for tag from, in the
+// order to try them: each mirror (<base>/<tag>/<asset>), then GitHub.
+func assetURLs(tag string) []string {
+	var urls []string
+	for _, m := range cfg.Mirrors {
+		urls = append(urls, strings.TrimRight(m, "/")+"/"+tag+"/"+assetName(tag))
+	}
+	return append(urls, assetURL(tag))
+}
+
+// Log levels for logf. -quiet lowers verbosity to levelError, which keeps
+// warnings, errors and the final summary but drops the menu, progress and file
+// list.
+const (
+	levelError = iota
+	levelInfo
+	levelDebug
+)
+
+// verbosity is the highest level logf prints; -v raises it to levelDebug.
+var verbosity = levelInfo
+
+// Prompt and output modes. SILENT=1 implies noninteractive (and -latest).
+var (
+	noninteractive = os.Getenv("SILENT") == "1" || os.Getenv("NONINTERACTIVE") == "1" // never prompt
+	quiet          = os.Getenv("QUIET") == "1"                                        // no menu, progress or file list
+	tuiMode        = false                                                            // -tui on a terminal: menu screen, progress bar
+	force          = os.Getenv("FORCE") == "1"                                        // rebuild existing archives without asking
+	noVerify       = os.Getenv("NO_VERIFY") == "1"                                    // don't re-read the built archive
+	keepDownload   = os.Getenv("KEEP_DOWNLOAD") == "1"                                // keep the download after a good build too
+	verifyExisting = os.Getenv("VERIFY_EXISTING") == "1"                              // fully test an existing archive before skipping it
+)
+
+// logf prints a line if level is enabled. Debug lines are tagged.
+func logf(level int, format string, args ...interface{}) {
+	if level > verbosity {
+		return
+	}
+	if level == levelDebug {
+		format = "[debug] " + format
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// jsonOut is the real stdout in -json mode, where all other output goes to
+// stderr. It is nil otherwise.
+var jsonOut *os.File
+
+// buildResult is the -json summary of a successful build.
+type buildResult struct {
+	SelectedTag       string `json:"selectedTag"`
+	Version           string `json:"version"`
+	OutputPath        string `json:"outputPath"`
+	FileCount         int    `json:"fileCount"`
+	UncompressedBytes uint64 `json:"uncompressedBytes"`
+	CompressedBytes   int64  `json:"compressedBytes"`
+	RemovedCount      int    `json:"removedCount"`
+	SHA256            string `json:"sha256"`
+
+	// Skipped is set when the existing archive was kept instead of rebuilt
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// fail reports a fatal error, as {"error": ...} in -json mode, and exits
+// with code.
+func fail(code int, format string, args ...interface{}) {
+	if downloadCtx.Err() != nil {
+		// Interrupted: this error is just the cancellation, and the signal
+		// handler is cleaning up and will exit with exitCancelled
+		select {}
+	}
+	msg := fmt.Sprintf(format, args...)
+	if jsonOut != nil {
+		json.NewEncoder(jsonOut).Encode(map[string]string{"error": msg})
+	} else {
+		logf(levelError, "%s", msg)
+	}
+	heldCacheLock()
+	os.Exit(code)
+}
+
+// emitResult writes the -json summary for finalZip. It does nothing
+// outside -json mode.
+func emitResult(tag, version, finalZip string, stats repack.Stats) {
+	writeResult(tag, version, finalZip, stats, false)
+}
+
+// emitSkipped writes the -json summary for an existing finalZip that is
+// kept instead of rebuilt, with the counts read from the archive itself.
+func emitSkipped(tag, version, finalZip string) {
+	if jsonOut == nil {
+		return
+	}
+	stats, err := archiveStats(finalZip)
+	if err != nil {
+		fail(exitBuild, "Error reading archive: %v", err)
+	}
+	writeResult(tag, version, finalZip, stats, true)
+}
+
+// writeResult encodes the buildResult for finalZip to jsonOut, if set.
+func writeResult(tag, version, finalZip string, stats repack.Stats, skipped bool) {
+	if jsonOut == nil {
+		return
+	}
+	fi, err := os.Stat(finalZip)
+	if err != nil {
+		fail(exitBuild, "Error reading archive: %v", err)
+	}
+	digest, err := fileSHA256(finalZip)
+	if err != nil {
+		fail(exitBuild, "Error hashing archive: %v", err)
+	}
+	enc := json.NewEncoder(jsonOut)
+	enc.SetIndent("", "  ")
+	enc.Encode(buildResult{
+		SelectedTag:       tag,
+		Version:           version,
+		OutputPath:        finalZip,
+		FileCount:         stats.Kept,
+		UncompressedBytes: stats.Uncompressed,
+		CompressedBytes:   fi.Size(),
+		RemovedCount:      stats.Removed,
+		SHA256:            digest,
+		Skipped:           skipped,
+	})
+}
+
+// archiveStats counts the files of a built archive and their size, leaving
+// out the metadata entry, and takes the removed count from that entry if
+// the archive has one.
+func archiveStats(path string) (repack.Stats, error) {
+	entries, err := listArchive(path)
+	if err != nil {
+		return repack.Stats{}, err
+	}
+	var stats repack.Stats
+	for _, e := range entries {
+		if e.Dir || e.Name == metaName() {
+			continue
+		}
+		stats.Kept++
+		stats.Uncompressed += e.Size
+	}
+	var meta buildMeta
+	if data, err := readArchiveEntry(path, metaName()); err == nil && json.Unmarshal(data, &meta) == nil {
+		stats.Removed = meta.RemovedFiles
+	}
+	return stats, nil
+}
+
+// readArchiveEntry returns the content of the entry called name in a .zip
+// or .tar.gz archive.
+func readArchiveEntry(path, name string) ([]byte, error) {
+	if !strings.HasSuffix(path, ".tar.gz") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		rc, err := r.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fs.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// rateLimit caps download speed in bytes per second (-limit); 0 means
+// unlimited.
+var rateLimit int
+
+// limiter is shared by every throttled reader, so ranges downloaded in
+// parallel stay under rateLimit together.
+var (
+	limiter     *rate.Limiter
+	limiterOnce sync.Once
+)
+
+// throttle wraps r so reads don't exceed rateLimit. Progress readers wrap
+// the result, so their percentage and ETA follow the throttled rate.
+func throttle(r io.Reader) io.Reader {
+	if rateLimit <= 0 {
+		return r
+	}
+	// A one-second burst keeps the token bucket close to the cap
+	limiterOnce.Do(func() { limiter = rate.NewLimiter(rate.Limit(rateLimit), rateLimit) })
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rl.limiter.Burst() {
+		p = p[:rl.limiter.Burst()]
+	}
+	n, err := rl.r.Read(p)
+	if n > 0 {
+		if werr := rl.limiter.WaitN(downloadCtx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// downloadCtx is cancelled on interrupt so in-flight downloads and
+// transcodes stop.
+var downloadCtx, cancelDownloads = context.WithCancel(context.Background())
+
+// runPhase names what the run is doing, for the -deadline message.
+var runPhase atomic.Value // string
+
+// setPhase records what the run is doing now.
+func setPhase(phase string) { runPhase.Store(phase) }
+
+// startDeadline gives the whole run d. When it is up, everything in flight
+// is cancelled and cleaned up as on an interrupt, and the builder exits with
+// exitDeadline, naming the phase it was in.
+func startDeadline(d time.Duration) {
+	setPhase("starting")
+	time.AfterFunc(d, func() {
+		termui.Restore() // a -tui menu may have the terminal in raw mode
+		msg := fmt.Sprintf("Error: -deadline %s ran out while %s", d, runPhase.Load())
+		fmt.Printf("\n%s; cleaning up...\n", msg)
+		cleanupInterrupted()
+		if jsonOut != nil {
+			json.NewEncoder(jsonOut).Encode(map[string]string{"error": msg})
+		}
+		os.Exit(exitDeadline)
+	})
+}
+
+// transcoding counts transcodes in flight, so an interrupt can let them
+// close their output before the cleanup deletes it.
+var transcoding atomic.Int32
+
+// Paths to delete if the build is interrupted: the temp workspace and any
+// partially written files.
+var (
+	cleanupMu    sync.Mutex
+	cleanupPaths []string
+)
+
+// removeOnInterrupt registers path for deletion if the build is interrupted.
+func removeOnInterrupt(path string) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanupPaths = append(cleanupPaths, path)
+}
+
+// keepOnInterrupt undoes removeOnInterrupt once path is complete.
+func keepOnInterrupt(path string) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for i, p := range cleanupPaths {
+		if p == path {
+			cleanupPaths = append(cleanupPaths[:i], cleanupPaths[i+1:]...)
+			break
+		}
+	}
+}
+
+// cleanupInterrupted cancels downloads and transcodes and deletes every
+// registered path.
+func cleanupInterrupted() {
+	cancelDownloads()
+	// A cancelled transcode stops at its next entry; give it a moment to
+	// close its .partial file, which Windows won't delete while it's open
+	for deadline := time.Now().Add(2 * time.Second); transcoding.Load() > 0 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+	}
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for _, p := range cleanupPaths {
+		os.RemoveAll(p)
+	}
+	cleanupPaths = nil
+}
+
+// The release-list request is tried up to releaseAttempts times, waiting
+// releaseRetryDelay after the first failure and twice as long after each
+// one that follows.
+const (
+	releaseAttempts   = 3
+	releaseRetryDelay = time.Second
+)
+
+// requestReleases asks the GitHub API for the release list. With an etag
+// the request is conditional, so an unchanged list comes back as a 304.
+// Network errors and 5xx responses are retried with backoff; the last
+// attempt's result is returned as is. Anything else, a rate limit included,
+// is returned at once. Retries are reported to rep.
+func requestReleases(rep report.Reporter, etag string) (*http.Response, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	delay := releaseRetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := requestReleasesOnce(client, etag)
+		transient := (err != nil && downloadCtx.Err() == nil) || (err == nil && resp.StatusCode >= 500)
+		if !transient || attempt == releaseAttempts {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = errors.New(resp.Status)
+		}
+		rep.Log(fmt.Sprintf("Warning: fetching the release list failed (%v), retrying in %s", err, delay))
+		select {
+		case <-downloadCtx.Done():
+			return nil, downloadCtx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// requestReleasesOnce makes a single release-list request for
+// requestReleases.
+func requestReleasesOnce(client *http.Client, tag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "GET", "https://api.github.com/repos/"+cfg.Repo+"/releases?per_page=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	if tag := etag.Normalize(tag); tag != "" {
+		req.Header.Set("If-None-Match", tag)
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	logf(levelDebug, "GET %s: %s", req.URL, resp.Status)
+	return resp, nil
+}
+
+// saveReleases caches a freshly fetched release list and the ETag it came
+// with. Nothing is written while the cache is read-only.
+func saveReleases(data []byte, etag string) {
+	if cacheReadOnly {
+		logf(levelDebug, "cache is locked by another instance, not saving the release list")
+		return
+	}
+	if err := githubCache.SaveReleases(data, etag); err != nil {
+		logf(levelDebug, "saving the release list: %v", err)
+	}
+}
+
+// cacheReadOnly is set while another instance holds the cache lock: the
+// cache is still read, but this run doesn't update it.
+var cacheReadOnly bool
+
+// heldCacheLock releases the cache lock while this run holds it. fail
+// calls it, since os.Exit skips every unlock still to come.
+var heldCacheLock = func() {}
+
+// staleLockAge is when a cache lock counts as left behind by a run that
+// died holding it. The lock is only held around a release list fetch,
+// which times out well before this.
+const staleLockAge = 2 * time.Minute
+
+// lockCache takes cacheDir/.lock, created with O_EXCL, for the release
+// list fetch so two instances can't interleave their updates of the list
+// and its ETag. If another instance holds it, cacheReadOnly is set and the
+// run carries on with the existing cache. The returned func releases the
+// lock and clears cacheReadOnly; fail releases a held lock too.
+func lockCache() (unlock func()) {
+	path, err := githubCache.Lock(staleLockAge)
+	if err == nil {
+		removeOnInterrupt(path)
+		heldCacheLock = sync.OnceFunc(func() {
+			os.Remove(path)
+			keepOnInterrupt(path)
+		})
+		return heldCacheLock
+	}
+	if !errors.Is(err, cache.ErrLocked) {
+		logf(levelDebug, "cache lock: %v", err) // the writes will likely fail too, but only cost a refetch
+		return func() {}
+	}
+	fmt.Println("Note: another instance is updating the cache; using it read-only")
+	cacheReadOnly = true
+	return func() { cacheReadOnly = false }
+}
+
+// httpGet is http.Get bound to downloadCtx, through downloadClient.
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return downloadClient.Do(req)
+}
+
+// downloadClient fetches release assets. It logs each redirect hop, so a
+// failed download shows where GitHub sent it on to its CDN.
+var downloadClient = &http.Client{CheckRedirect: logRedirect}
+
+// logRedirect is downloadClient's CheckRedirect: it logs the hop at debug
+// level and keeps net/http's default limit of 10 redirects.
+func logRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	prev, status := via[len(via)-1], "redirect"
+	if req.Response != nil {
+		status = req.Response.Status
+	}
+	logf(levelDebug, "%s %s: %s, to %s", prev.Method, prev.URL, status, req.URL)
+	return nil
+}
+
+// statusError describes a download that got HTTP status instead of the
+// asset. A 404 names the requested URL and, if a redirect led elsewhere,
+// the final one, which tells a wrong asset name from a bad redirect.
+func statusError(resp *http.Response, url string) error {
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if final := resp.Request.URL.String(); final != url {
+		return fmt.Errorf("HTTP %s for %s (redirected to %s)", resp.Status, url, final)
+	}
+	return fmt.Errorf("HTTP %s for %s", resp.Status, url)
+}
+
+// handleInterrupts cleans up and exits with code 130 on SIGINT/SIGTERM.
+func handleInterrupts() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		termui.Restore()
+		fmt.Println("\n==> Interrupted, cleaning up...")
+		cleanupInterrupted()
+		os.Exit(exitCancelled)
+	}()
+}
+
+// Set at link time by build.sh (-X main.builderVersion=... etc.).
+var (
+	builderVersion   = "dev"
+	builderCommit    = ""
+	builderBuildTime = ""
+)
+
+// versionString reports the builder's version, commit and Go version.
+// Values stamped by build.sh win; otherwise the embedded build info fills in
+// what it can.
+func versionString() string {
+	version, commit := builderVersion, builderCommit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && commit == "" {
+				commit = s.Value
+			}
+		}
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	details := "commit " + commit
+	if builderBuildTime != "" {
+		details += ", built " + builderBuildTime
+	}
+	return fmt.Sprintf("REFramework Builder %s (%s, %s)", version, details, runtime.Version())
+}
+
+// metaFile is the build-info entry added to every output archive, under
+// the prefix folder.
+const metaFile = "_reframework_builder.json"
+
+// metaName is metaFile with the prefix folder.
+func metaName() string {
+	return prefixed(metaFile)
+}
+
+// buildMeta is the content of metaName: where the archive came from and
+// what the builder removed.
+type buildMeta struct {
+	Builder        string     `json:"builder"`
+	BuilderVersion string     `json:"builderVersion"`
+	BuilderBuilt   string     `json:"builderBuildTime,omitempty"`
+	SourceTag      string     `json:"sourceTag,omitempty"`
+	SourceFile     string     `json:"sourceFile,omitempty"`
+	PublishedAt    *time.Time `json:"publishedAt,omitempty"`
+	FilterMode     string     `json:"filterMode"`
+	Patterns       []string   `json:"patterns"`
+	OnlyDirs       []string   `json:"onlyDirs,omitempty"`
+	RemovedFiles   int        `json:"removedFiles"`
+}
+
+// newBuildMeta describes a build of tag (or, for -input, the local file
+// src, whose publish date is unknown). It returns nil when NO_METADATA=1.
+func newBuildMeta(tag, src string, published time.Time, filters repack.FilterSet) *buildMeta {
+	if os.Getenv("NO_METADATA") == "1" {
+		return nil
+	}
+	m := &buildMeta{
+		Builder:        "REFrameworkBuilder-MHWilds-noVR",
+		BuilderVersion: builderVersion,
+		BuilderBuilt:   builderBuildTime,
+		SourceTag:      tag,
+		FilterMode:     "exclude",
+		Patterns:       filters.Patterns,
+		OnlyDirs:       filters.OnlyDirs,
+	}
+	if tag == "" {
+		m.SourceFile = filepath.Base(src)
+	} else {
+		t := published.UTC()
+		m.PublishedAt = &t
+	}
+	if filters.KeepOnly {
+		m.FilterMode = "keep"
+	}
+	return m
+}
+
+// metaJSON returns the metadata entry's content with the removed count set.
+func metaJSON(m *buildMeta, stats repack.Stats) ([]byte, error) {
+	m.RemovedFiles = stats.Removed
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ruleCounts lists how many entries each rule dropped as "count  rule"
+// lines, the rule that dropped the most first.
+func ruleCounts(counts map[string]int) []string {
+	rules := make([]string, 0, len(counts))
+	for r := range counts {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	lines := make([]string, len(rules))
+	for i, r := range rules {
+		lines[i] = fmt.Sprintf("%5d  %s", counts[r], r)
+	}
+	return lines
+}
+
+// parseOnlyDirs parses the comma-separated -only-dirs list. Each name must
+// be a single top-level file or folder of the source archive.
+func parseOnlyDirs(s string) ([]string, error) {
+	var dirs []string
+	for _, d := range splitPatterns(s) {
+		name := strings.Trim(d, "/")
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("-only-dirs takes top-level names, got %q", d)
+		}
+		dirs = append(dirs, name)
+	}
+	return dirs, nil
+}
+
+// topLevelNames lists the distinct top-level files and folders in a zip.
+func topLevelNames(src string) ([]string, error) {
+	r, err := openZip(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var names []string
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		top, _, _ := strings.Cut(strings.TrimPrefix(f.Name, root), "/")
+		if top != "" && !slices.Contains(names, top) {
+			names = append(names, top)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// reportTopLevel lists the source's top-level names when -only-dirs is in
+// use, so the right names are easy to find, and warns about missing ones.
+func reportTopLevel(src string, filters repack.FilterSet) {
+	if len(filters.OnlyDirs) == 0 {
+		return
+	}
+	names, err := topLevelNames(src)
+	if err != nil {
+		return // the caller opens src next and reports the error
+	}
+	fmt.Printf("==> Top-level entries in %s: %s\n", filepath.Base(src), strings.Join(names, ", "))
+	for _, d := range filters.OnlyDirs {
+		if !slices.Contains(names, d) {
+			logf(levelError, "Warning: -only-dirs %s is not in the source", d)
+		}
+	}
+}
+
+// extendFilters applies FILTERS/-filters and EXTRA_FILTERS/-exclude to an
+// exclude list: replace, if set, takes the place of patterns, and extra is
+// appended to the result. Either one being set but holding no patterns is
+// an error.
+func extendFilters(patterns []string, replace, extra string) ([]string, error) {
+	if replace != "" {
+		if patterns = splitPatterns(replace); len(patterns) == 0 {
+			return nil, errors.New("-filters (FILTERS) contains no patterns")
+		}
+	}
+	if extra != "" {
+		more := splitPatterns(extra)
+		if len(more) == 0 {
+			return nil, errors.New("-exclude (EXTRA_FILTERS) contains no patterns")
+		}
+		// A fresh slice, so the config's list isn't appended to in place
+		patterns = append(append([]string(nil), patterns...), more...)
+	}
+	return patterns, nil
+}
+
+// splitPatterns parses a comma-separated pattern list, dropping blanks.
+func splitPatterns(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// printTestSummary reports what a SKIP_DOWNLOAD=1 run would have built. With
+// a local input archive it also counts the files the filters keep and remove,
+// so the selection, naming and filter logic can be exercised offline.
+func printTestSummary(tag, version, finalZip string, filters repack.FilterSet, input string) error {
+	fmt.Printf("Selected tag: %s\nVersion: %s\nDownload URL: %s\nWould create: %s\nFilters: %s\n",
+		tag, version, assetURL(tag), finalZip, filters)
+	if input == "" {
+		return nil
+	}
+	total, removed, err := countEntries(input, filters)
 	if err != nil {
 		return err
 	}
-	defer dFile.Close()
+	fmt.Printf("Input %s: %d file(s), %d kept, %d removed\n", input, total, total-removed, removed)
+	return nil
+}
+
+// countEntries returns how many files src holds and how many of them the
+// filters would remove.
+func countEntries(src string, filters repack.FilterSet) (total, removed int, err error) {
+	r, err := openZip(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		total++
+		if drop, _ := filters.Match(strings.TrimPrefix(f.Name, root)); drop {
+			removed++
+		}
+	}
+	return total, removed, nil
+}
 
-	dWriter := zip.NewWriter(dFile)
-	defer dWriter.Close()
+// dryRun prints which entries of src the filters would keep and remove,
+// side by side with per-group totals and how many files each rule removed,
+// without writing an output archive.
+func dryRun(src string, filters repack.FilterSet) error {
+	reportTopLevel(src, filters)
+	r, err := openZip(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
 
-	// Ensure the root "MHWILDS/" directory entry exists
-	_, _ = dWriter.Create("MHWILDS/")
+	var kept, removed []string
+	var keptSize, removedSize uint64
+	byRule := make(map[string]int)
+	width := len("KEPT")
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.TrimPrefix(f.Name, root)
+		if drop, rule := filters.Match(name); drop {
+			removed = append(removed, name+"  ["+rule+"]")
+			removedSize += f.UncompressedSize64
+			byRule[rule]++
+		} else {
+			kept = append(kept, name)
+			keptSize += f.UncompressedSize64
+			width = max(width, len(name))
+		}
+	}
 
-	for _, f := range sReader.File {
-		// Filter out files matching any of the patterns
-		skip := false
-		for _, pattern := range filters {
-			if strings.Contains(f.Name, pattern) {
-				skip = true
-				break
-			}
+	fmt.Printf("Dry run (%s), %s\n", filepath.Base(src), filters)
+	fmt.Printf("  %-*s  %s\n", width, "KEPT", "REMOVED")
+	for i := 0; i < max(len(kept), len(removed)); i++ {
+		var k, rm string
+		if i < len(kept) {
+			k = kept[i]
+		}
+		if i < len(removed) {
+			rm = removed[i]
+		}
+		fmt.Printf("  %-*s  %s\n", width, k, rm)
+	}
+	fmt.Printf("Kept: %d file(s), %s | Removed: %d file(s), %s\n",
+		len(kept), formatSize(keptSize), len(removed), formatSize(removedSize))
+	if len(byRule) > 0 {
+		fmt.Println("Removed by rule:")
+		for _, line := range ruleCounts(byRule) {
+			fmt.Println("  " + line)
+		}
+	}
+	return nil
+}
+
+// verifyArchive checks a built archive against filters: every entry must be
+// under the archive prefix, and none may be one the filters would have removed. It
+// returns one line per violation.
+func verifyArchive(path string, filters repack.FilterSet) ([]string, error) {
+	names, err := archiveNames(path)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, name := range names {
+		rel, ok := strings.CutPrefix(name, prefixed(""))
+		if !ok {
+			problems = append(problems, "outside "+prefixed("")+": "+name)
+			continue
 		}
-		if skip {
+		if rel == "" || name == metaName() {
 			continue
 		}
+		if drop, rule := filters.Match(rel); drop {
+			problems = append(problems, "should have been removed: "+name+" ("+rule+")")
+		}
+	}
+	return problems, nil
+}
 
-		// Prepend "MHWILDS/" to the name for parity with shell script
-		zipPath := "MHWILDS/" + f.Name
+// archiveNames lists the entry names of a .zip or .tar.gz archive.
+func archiveNames(path string) ([]string, error) {
+	var names []string
+	if !strings.HasSuffix(path, ".tar.gz") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		return names, nil
+	}
 
-		// Direct stream from source entry to dest writer
-		srcFile, err := f.Open()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names, nil
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+		names = append(names, hdr.Name)
+	}
+}
 
-		destFile, err := dWriter.CreateHeader(&zip.FileHeader{
-			Name:     zipPath,
-			Method:   zip.Deflate,
-			Modified: f.Modified,
-		})
+// checkExisting tells whether the archive an earlier run left at finalZip
+// can still be read, since an interrupted run or a full disk can leave one
+// that can't. It reads the entry list (the central directory of a zip)
+// and, with full, every entry's data and checksum too.
+func checkExisting(finalZip string, full bool) error {
+	if _, err := listArchive(finalZip); err != nil {
+		return err
+	}
+	if !full {
+		return nil
+	}
+	format := "zip"
+	if strings.HasSuffix(finalZip, ".tar.gz") {
+		format = "tgz"
+	}
+	return testArchive(downloadCtx, finalZip, format)
+}
+
+// existingUsable is checkExisting for the "archive exists" prompt. A
+// damaged archive is reported and counts as missing, so it is rebuilt
+// without asking whether to skip it.
+func existingUsable(finalZip string) bool {
+	err := checkExisting(finalZip, verifyExisting)
+	if err != nil {
+		logf(levelError, "Warning: the existing %s is damaged (%v); rebuilding it.", finalZip, err)
+	}
+	return err == nil
+}
+
+// testArchive reads every entry of the archive at path (format "zip" or
+// "tgz") to the end, the way unzip -t does, so a truncated file or a bad
+// checksum turns into an error.
+func testArchive(ctx context.Context, path, format string) error {
+	if format != "tgz" {
+		r, err := zip.OpenReader(path)
 		if err != nil {
-			srcFile.Close()
 			return err
 		}
+		defer r.Close()
+		for _, f := range r.File {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			_, err = io.Copy(io.Discard, rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		return nil
+	}
 
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return err
 		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
 	}
-	return nil
+	// The gzip checksum is only checked once the stream is read to its end
+	_, err = io.Copy(io.Discard, gz)
+	return err
+}
+
+// forbiddenReason explains a 403 or 429 from the GitHub API. A rate limit
+// (no requests remaining, or a Retry-After) reports when it resets; anything
+// else is an access failure, usually a bad GITHUB_TOKEN.
+func forbiddenReason(resp *http.Response) string {
+	h := resp.Header
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		h.Get("X-RateLimit-Remaining") == "0" || h.Get("Retry-After") != ""
+	if !limited {
+		if os.Getenv("GITHUB_TOKEN") != "" {
+			return fmt.Sprintf("GitHub API denied access (%d); check that GITHUB_TOKEN is valid", resp.StatusCode)
+		}
+		return fmt.Sprintf("GitHub API denied access (%d)", resp.StatusCode)
+	}
+
+	msg := "GitHub API rate limit exceeded"
+	if wait, ok := rateLimitReset(h, time.Now()); ok {
+		msg += fmt.Sprintf("; it resets in %s", wait.Round(time.Second))
+	}
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		msg += ". Set GITHUB_TOKEN to a GitHub token for a higher limit"
+	}
+	return msg
+}
+
+// rateLimitReset returns how long until the API rate limit resets, from
+// Retry-After (seconds) or X-RateLimit-Reset (Unix time).
+func rateLimitReset(h http.Header, now time.Time) (time.Duration, bool) {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if s, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return max(time.Unix(s, 0).Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// updateCheck is the cached result of the last update check.
+type updateCheck struct {
+	Repo      string    `json:"repo"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest"`
+	URL       string    `json:"url"`
+}
+
+// checkForUpdate returns the latest release of the builder itself if it is
+// newer than this build. The answer is cached for a day. Dev builds,
+// NO_UPDATE_CHECK=1 and failed checks report nothing.
+func checkForUpdate() (tag, url string, ok bool) {
+	if os.Getenv("NO_UPDATE_CHECK") == "1" || !strings.HasPrefix(builderVersion, "v") {
+		return "", "", false
+	}
+	var c updateCheck
+	path := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "reframework-builder", "update-check.json")
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &c)
+		}
+	}
+	if c.Repo != cfg.UpdateRepo || time.Since(c.CheckedAt) > 24*time.Hour {
+		latest, u, err := latestBuilderRelease(cfg.UpdateRepo)
+		if err != nil {
+			logf(levelDebug, "update check: %v", err)
+			return "", "", false
+		}
+		c = updateCheck{Repo: cfg.UpdateRepo, CheckedAt: time.Now(), Latest: latest, URL: u}
+		if path != "" && os.MkdirAll(filepath.Dir(path), 0755) == nil {
+			if data, err := json.Marshal(c); err == nil {
+				cache.WriteFileAtomic(path, data)
+			}
+		}
+	}
+	return c.Latest, c.URL, newerVersion(c.Latest, builderVersion)
+}
+
+// latestBuilderRelease returns the tag and page URL of repo's latest release.
+func latestBuilderRelease(repo string) (string, string, error) {
+	u := "https://api.github.com/repos/" + repo + "/releases/latest"
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	logf(levelDebug, "GET %s: %s", u, resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("API returned %s", resp.Status)
+	}
+	var rel struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return "", "", err
+	}
+	return rel.TagName, rel.HTMLURL, nil
+}
+
+// newerVersion reports whether tag a is a later vX.Y.Z than b. Anything
+// after a "-" (such as a git describe suffix) is ignored.
+func newerVersion(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// versionParts returns the leading numeric components of a vX.Y.Z tag.
+func versionParts(v string) []int {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// updateNotice receives the update check's message, if there is one.
+var updateNotice = make(chan string, 1)
+
+// startUpdateCheck runs checkForUpdate in the background so it never delays
+// a build; showUpdateNotice prints the result if it has arrived by then.
+func startUpdateCheck() {
+	go func() {
+		if tag, url, ok := checkForUpdate(); ok {
+			updateNotice <- fmt.Sprintf("A newer version of this builder is available: %s\n    %s", tag, url)
+		}
+	}()
+}
+
+func showUpdateNotice() {
+	select {
+	case msg := <-updateNotice:
+		fmt.Println("==> " + msg)
+	default:
+	}
+}
+
+// sizeSummary formats the size line shown after a build.
+func sizeSummary(uncompressed, compressed uint64, files int) string {
+	ratio := 0.0
+	if uncompressed > 0 {
+		ratio = float64(compressed) * 100 / float64(uncompressed)
+	}
+	return fmt.Sprintf("Uncompressed: %s, Compressed: %s (%.1f%% ratio), Files: %d",
+		formatSize(uncompressed), formatSize(compressed), ratio, files)
+}
+
+// parseSize reads a byte count with an optional B, KB, MB or GB suffix
+// (powers of 1024, as formatSize prints them), like "45MB" or "1.5 GB".
+func parseSize(s string) (uint64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mult := 1.0
+	for _, u := range []struct {
+		suffix string
+		mult   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(t, u.suffix) {
+			t, mult = strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want a size like 45MB or a number of bytes, got %q", s)
+	}
+	return uint64(n * mult), nil
+}
+
+// formatSize renders a byte count as a human-readable string.
+func formatSize(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// progressJSON is set by -progress-json: progress goes to stderr as one
+// JSON object per line, for a parent process to draw, instead of the
+// redrawn terminal line.
+var progressJSON bool
+
+// progressEvent is one -progress-json line. Phase is download, transcode
+// or done; Pct runs from 0 to 1, File is the archive entry being written
+// and Output the finished archive.
+type progressEvent struct {
+	Phase  string   `json:"phase"`
+	Pct    *float64 `json:"pct,omitempty"`
+	File   string   `json:"file,omitempty"`
+	Output string   `json:"output,omitempty"`
+}
+
+var progressMu sync.Mutex
+
+// writeProgress writes ev to stderr as a line of its own.
+func writeProgress(ev progressEvent) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	json.NewEncoder(os.Stderr).Encode(ev)
+}
+
+// progressDone reports the finished archive with -progress-json.
+func progressDone(output string) {
+	if progressJSON {
+		writeProgress(progressEvent{Phase: "done", Output: output})
+	}
+}
+
+// jsonProgress turns the progress of one phase into events. It only writes
+// one when the whole percentage or the entry changes, so a download doesn't
+// produce an event per read.
+type jsonProgress struct {
+	phase string
+
+	mu   sync.Mutex
+	file string
+	pct  int
+	sent bool // an event with pct and file went out
+}
+
+// Progress records frac, writing an event when its whole percentage changes.
+func (p *jsonProgress) Progress(frac float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	frac = min(max(frac, 0), 1)
+	if pct := int(frac * 100); !p.sent || pct != p.pct {
+		p.pct, p.sent = pct, true
+		writeProgress(progressEvent{Phase: p.phase, Pct: &frac, File: p.file})
+	}
+}
+
+// entry sets the archive entry the next event names.
+func (p *jsonProgress) entry(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if name != p.file {
+		p.file, p.sent = name, false
+	}
+}
+
+// jsonReporter is the Reporter of a phase with -progress-json. Status and
+// log lines are printed as usual; progress goes out as events.
+type jsonReporter struct {
+	report.Terminal
+	progress jsonProgress
+}
+
+func (r *jsonReporter) Progress(frac float64) { r.progress.Progress(frac) }
+func (r *jsonReporter) Entry(name string)     { r.progress.entry(name) }
+
+// newReporter returns the Reporter for one phase of a single build:
+// "fetch", "download" or "transcode". With -progress-json its progress goes
+// out as events; otherwise a download draws its own progress line and the
+// other phases a report.Terminal.
+func newReporter(phase string) report.Reporter {
+	quiet := verbosity < levelInfo
+	switch {
+	case progressJSON:
+		return &jsonReporter{Terminal: report.Terminal{Quiet: quiet}, progress: jsonProgress{phase: phase}}
+	case phase == "download":
+		return &downloadLine{quiet: quiet}
+	}
+	return &report.Terminal{Quiet: quiet}
+}
+
+// downloadLine is the terminal Reporter for a download: Status and Log
+// print lines, and Progress redraws the "==> Downloading" line with an
+// estimate of the time left. Quiet drops Status and Progress.
+type downloadLine struct {
+	quiet bool
+
+	mu    sync.Mutex
+	start time.Time // of the first Progress
+	open  bool      // the progress line is on screen without its newline
+}
+
+func (d *downloadLine) Status(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endLine()
+	if !d.quiet {
+		fmt.Println(msg)
+	}
+}
+
+func (d *downloadLine) Log(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endLine()
+	fmt.Println(msg)
+}
+
+func (d *downloadLine) Progress(frac float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.quiet {
+		return
+	}
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+	frac = min(max(frac, 0), 1)
+	if tuiMode {
+		fmt.Printf("\r==> Downloading %s %s %5.1f%%%s", cfg.AssetName, termui.Bar(frac, 30), frac*100, d.eta(frac))
+	} else {
+		fmt.Printf("\r==> Downloading %s... [%.2f%%]%s", cfg.AssetName, frac*100, d.eta(frac))
+	}
+	d.open = true
+}
+
+// EndLine finishes the progress line after the download, or after it
+// failed.
+func (d *downloadLine) EndLine() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endLine()
+}
+
+func (d *downloadLine) endLine() {
+	if d.open {
+		fmt.Println()
+		d.open = false
+	}
+}
+
+// eta estimates the time left from the average rate so far, padded to
+// overwrite a longer previous estimate.
+func (d *downloadLine) eta(frac float64) string {
+	elapsed := time.Since(d.start)
+	if elapsed < time.Second || frac == 0 {
+		return ""
+	}
+	left := time.Duration((1 - frac) / frac * float64(elapsed))
+	return fmt.Sprintf(" ETA %-8s", left.Round(time.Second))
 }
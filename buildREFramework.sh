@@ -1,9 +1,14 @@
 #!/bin/bash
 set -euo pipefail
 
-# Function to display a progress-like header
+# Function to display a progress-like header (colored only on a terminal
+# and when NO_COLOR is unset)
 status() {
-    printf "\033[1;34m==>\033[0m %s\n" "$1"
+    if [ -t 1 ] && [ -z "${NO_COLOR+x}" ]; then
+        printf "\033[1;34m==>\033[0m %s\n" "$1"
+    else
+        printf "==> %s\n" "$1"
+    fi
 }
 
 # Check dependencies
@@ -14,9 +19,15 @@ for cmd in curl zip unzip; do
     fi
 done
 
+# Remove work dirs left by runs that crashed or were killed (older than 1 hour)
+if [ "${NO_TEMP_CLEANUP:-0}" != "1" ]; then
+    find /dev/shm "${TMPDIR:-/tmp}" -maxdepth 1 -type d -name 'reframework-*' -mmin +60 \
+        -exec rm -rf {} + 2>/dev/null || true
+fi
+
 # Setup cleanup trap
 # Use RAM disk if available for better performance
-TMP_ROOT=$(mktemp -d -p /dev/shm 2>/dev/null || mktemp -d)
+TMP_ROOT=$(mktemp -d -p /dev/shm reframework-XXXXXX 2>/dev/null || mktemp -d -t reframework-XXXXXX)
 cleanup() {
     rm -rf "$TMP_ROOT" MHWILDS.zip
 }
@@ -37,7 +48,12 @@ if [ -t 0 ] && [ "${SILENT:-0}" != "1" ]; then
     fi
 fi
 
-CACHE_DIR=".cache_github"
+# Same cache folder as the Go builders; move one left in the CWD by older versions
+CACHE_DIR="${CACHE_DIR:-${XDG_CACHE_HOME:-$HOME/.cache}/reframework-builder/github}"
+if [ -d ".cache_github" ] && [ ! -e "$CACHE_DIR" ]; then
+    mkdir -p "$(dirname "$CACHE_DIR")"
+    mv ".cache_github" "$CACHE_DIR" && echo "==> Moved .cache_github to $CACHE_DIR"
+fi
 mkdir -p "$CACHE_DIR"
 CACHE_BODY="$CACHE_DIR/releases.json"
 CACHE_HEADERS="$CACHE_DIR/headers.tmp"
@@ -236,6 +252,12 @@ mkdir -p "$TMP_EXTRACT_DIR/MHWILDS"
 if [ -s "$TMP_ROOT/unzip_error" ]; then
     grep -v "caution: excluded filename not matched" "$TMP_ROOT/unzip_error" >&2 || true
 fi
+# Some source zips already wrap everything in MHWILDS/; don't nest it twice
+if [ "$(ls -A "$TMP_EXTRACT_DIR/MHWILDS")" = "MHWILDS" ] && [ -d "$TMP_EXTRACT_DIR/MHWILDS/MHWILDS" ]; then
+    mv "$TMP_EXTRACT_DIR/MHWILDS" "$TMP_EXTRACT_DIR/nested"
+    mv "$TMP_EXTRACT_DIR/nested/MHWILDS" "$TMP_EXTRACT_DIR/MHWILDS"
+    rmdir "$TMP_EXTRACT_DIR/nested"
+fi
 
 # 4. Creating optimized archive
 status "Creating optimized archive: $EXPECTED_ZIP"
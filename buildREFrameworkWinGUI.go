@@ -2,68 +2,152 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"buildREFramework/cache"
+	"buildREFramework/etag"
+	"buildREFramework/install"
+	"buildREFramework/naming"
+	"buildREFramework/release"
+	"buildREFramework/repack"
+	"buildREFramework/report"
+	"buildREFramework/stamp"
+	"buildREFramework/workdir"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"golang.org/x/time/rate"
 
 	"image/color"
 )
 
 const (
-	repoAPI   = "https://api.github.com/repos/praydog/REFramework-nightly/releases"
-	cacheDir  = ".cache_github"
-	cacheBody = cacheDir + "/releases.json"
-	cacheEtag = cacheDir + "/etag"
-	zipName   = "MHWILDS.zip"
+	defaultRepo    = "praydog/REFramework-nightly"
+	defaultProfile = "novr"
+	builderRepo    = "VonZippySays/REFrameworkBuilder-MHWilds-noVR"
+	zipName        = "MHWILDS.zip"
+	defaultGame    = "MHWILDS"
+
+	appID         = "com.vonzippysays.reframeworkbuilder"
+	prefWinWidth  = "windowWidth"
+	prefWinHeight = "windowHeight"
+	prefLastNum   = "lastVersion"
+	prefNotify    = "notifications"
+	prefProfile   = "filterProfile"
 )
 
-type Release struct {
-	TagName     string    `json:"tag_name"`
-	PublishedAt time.Time `json:"published_at"`
-}
+// Process exit codes, so scripts can tell failures apart.
+const (
+	exitOK        = 0
+	exitUsage     = 2   // bad env vars or config
+	exitNetwork   = 3   // GitHub API or download failed
+	exitBuild     = 4   // reading, writing or installing archives failed
+	exitCancelled = 130 // user cancelled or closed the window mid-build
+)
+
+// exitCode is the status the process exits with once the app quits, and
+// buildFinished is set once closing the window no longer cancels anything.
+var (
+	exitCode      atomic.Int32
+	buildFinished atomic.Bool
+)
+
+// cfg holds the effective settings: config.json overlaid with env and flags.
+var cfg Config
 
 type ProgressReader struct {
 	io.Reader
-	Total      int64
-	Current    int64
-	OnProgress func(float64)
+	Total   int64
+	Current int64
+	Rep     report.Reporter // gets the fraction done; nil reports nothing
+	mu      sync.Mutex      // guards Current across Part readers
 }
 
 func (pr *ProgressReader) Read(p []byte) (int, error) {
 	n, err := pr.Reader.Read(p)
+	pr.add(n)
+	return n, err
+}
+
+// Part wraps r, one of several ranges downloaded in parallel, so that its
+// bytes count toward pr's progress.
+func (pr *ProgressReader) Part(r io.Reader) io.Reader {
+	return &partReader{r: r, pr: pr}
+}
+
+type partReader struct {
+	r  io.Reader
+	pr *ProgressReader
+}
+
+func (p *partReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pr.add(n)
+	return n, err
+}
+
+// add counts n more bytes and reports the new fraction to Rep.
+func (pr *ProgressReader) add(n int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
 	pr.Current += int64(n)
-	if pr.Total > 0 && pr.OnProgress != nil {
-		pr.OnProgress(float64(pr.Current) / float64(pr.Total))
+	if pr.Total > 0 && pr.Rep != nil {
+		pr.Rep.Progress(float64(pr.Current) / float64(pr.Total))
 	}
-	return n, err
+}
+
+// Verify reports a truncated download: fewer (or more) bytes read than the
+// server's Content-Length. Unknown lengths are not checked.
+func (pr *ProgressReader) Verify() error {
+	if pr.Total >= 0 && pr.Current != pr.Total {
+		return fmt.Errorf("download truncated: got %d of %d bytes", pr.Current, pr.Total)
+	}
+	return nil
 }
 
 var (
-	fyneApp fyne.App
-	fyneWin fyne.Window
+	fyneApp     fyne.App
+	fyneWin     fyne.Window
 	statusLabel *widget.Label
 	progressBar *widget.ProgressBar
+	fileLabel   *widget.Label
 	logText     *widget.Label
 )
 
+// progressInterval is the least time between two repacking progress updates,
+// so large archives don't redraw the window once per entry.
+const progressInterval = 100 * time.Millisecond
+
 // setStatus updates the status label on the main window from any goroutine.
 func setStatus(msg string) {
+	writeLogFile("status: " + msg)
 	statusLabel.SetText(msg)
 }
 
@@ -72,8 +156,15 @@ func setProgress(v float64) {
 	progressBar.SetValue(v)
 }
 
+// setCurrentFile shows the entry being processed under the progress bar, or
+// clears the line when name is empty.
+func setCurrentFile(name string) {
+	fileLabel.SetText(name)
+}
+
 // showLog appends a line to the log area.
 func showLog(msg string) {
+	writeLogFile(msg)
 	current := logText.Text
 	if current != "" {
 		logText.SetText(current + "\n" + msg)
@@ -82,77 +173,335 @@ func showLog(msg string) {
 	}
 }
 
-// askEntry shows a blocking text-entry dialog. Returns ("", false) on cancel.
+// fyneReporter is the report.Reporter behind the main window: status
+// label, progress bar, current-entry line and log. Progress redraws are
+// limited to one per progressInterval.
+type fyneReporter struct {
+	mu    sync.Mutex
+	entry string
+	last  time.Time
+}
+
+func (r *fyneReporter) Status(msg string) { setStatus(msg) }
+func (r *fyneReporter) Log(msg string)    { showLog(msg) }
+
+// Entry remembers the entry being processed for the next Progress redraw.
+func (r *fyneReporter) Entry(name string) {
+	r.mu.Lock()
+	r.entry = name
+	r.mu.Unlock()
+}
+
+func (r *fyneReporter) Progress(frac float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if frac < 1 && time.Since(r.last) < progressInterval {
+		return
+	}
+	r.last = time.Now()
+	setProgress(frac)
+	if r.entry != "" {
+		setCurrentFile("Repacking: " + r.entry)
+	}
+}
+
+// askEntry shows a blocking text-entry dialog with the entry focused; Enter
+// submits it and Escape cancels. Returns ("", false) on cancel.
 func askEntry(title, label, defaultVal string) (string, bool) {
-	ch := make(chan struct{ val string; ok bool }, 1)
-	entry := widget.NewEntry()
+	ch := make(chan struct {
+		val string
+		ok  bool
+	}, 1)
+	entry := newEscEntry()
 	entry.SetText(defaultVal)
 	entry.Resize(fyne.NewSize(400, 40))
 	items := []*widget.FormItem{
 		{Text: label, Widget: entry},
 	}
+	restoreKeys := func() {}
 	d := dialog.NewForm(title, "OK", "Cancel", items, func(ok bool) {
-		ch <- struct{ val string; ok bool }{entry.Text, ok}
+		restoreKeys()
+		ch <- struct {
+			val string
+			ok  bool
+		}{entry.Text, ok}
 	}, fyneWin)
+	entry.OnSubmitted = func(string) { d.Submit() }
+	entry.onEscape = d.Hide
 	d.Resize(fyne.NewSize(500, 220))
 	d.Show()
+	restoreKeys = dialogKeys(d.Submit, d.Hide)
+	fyneWin.Canvas().Focus(entry)
 	result := <-ch
 	return result.val, result.ok
 }
 
-// askConfirm shows a blocking yes/no dialog. Returns true on Yes.
+// askConfirm shows a blocking yes/no dialog. Returns true on Yes; Enter
+// answers Yes and Escape No.
 func askConfirm(title, msg string) bool {
 	ch := make(chan bool, 1)
+	restoreKeys := func() {}
 	d := dialog.NewConfirm(title, msg, func(ok bool) {
+		restoreKeys()
 		ch <- ok
 	}, fyneWin)
 	d.Resize(fyne.NewSize(500, 220))
 	d.Show()
+	restoreKeys = dialogKeys(d.Confirm, d.Hide)
 	return <-ch
 }
 
-// askList shows a blocking scrollable list dialog. Returns ("", false) on cancel.
-func askList(title string, options []string) (string, bool) {
-	ch := make(chan struct{ val string; ok bool }, 1)
+// dialogKeys sends Enter and Escape typed while no widget has focus to
+// onEnter and onEscape (either may be nil), as long as the dialog just shown
+// is the top one: a dialog opened over it gets its keys to itself. The
+// returned func puts the window's previous handler back.
+func dialogKeys(onEnter, onEscape func()) (restore func()) {
+	c := fyneWin.Canvas()
+	prev := c.OnTypedKey()
+	depth := len(c.Overlays().List())
+	c.SetOnTypedKey(func(ev *fyne.KeyEvent) {
+		top := len(c.Overlays().List()) == depth
+		switch {
+		case top && (ev.Name == fyne.KeyReturn || ev.Name == fyne.KeyEnter) && onEnter != nil:
+			onEnter()
+		case top && ev.Name == fyne.KeyEscape && onEscape != nil:
+			onEscape()
+		case prev != nil:
+			prev(ev)
+		}
+	})
+	return func() { c.SetOnTypedKey(prev) }
+}
 
-	list := widget.NewList(
-		func() int { return len(options) },
-		func() fyne.CanvasObject {
-			lbl := widget.NewLabel("")
-			lbl.Wrapping = fyne.TextWrapOff
-			return lbl
-		},
-		func(id widget.ListItemID, obj fyne.CanvasObject) {
-			obj.(*widget.Label).SetText(options[id])
-		},
-	)
+// escEntry is a widget.Entry that reports Escape, which the plain entry
+// swallows, so a focused entry doesn't stop Escape from closing its dialog.
+type escEntry struct {
+	widget.Entry
+	onEscape func()
+}
+
+func newEscEntry() *escEntry {
+	e := &escEntry{}
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *escEntry) TypedKey(ev *fyne.KeyEvent) {
+	if ev.Name == fyne.KeyEscape && e.onEscape != nil {
+		e.onEscape()
+		return
+	}
+	e.Entry.TypedKey(ev)
+}
+
+// askList shows a blocking scrollable list dialog with options[preselect]
+// highlighted (none if preselect < 0). A search box above the list narrows
+// the options to those containing its text. If rels is non-nil, rels[i] is
+// the release behind options[i], extra buttons act on the selected one and
+// its asset size shows next to them. The list has the keyboard focus at first, and Escape cancels from the
+// list, the search box or with nothing focused. Returns ("", false) on
+// cancel.
+func askList(title string, options []string, preselect int, rels []release.Release) (string, bool) {
+	ch := make(chan struct {
+		val string
+		ok  bool
+	}, 1)
+
+	// finish answers the dialog; only the first call (of possibly several
+	// rapid double-clicks or key presses) gets through
+	var once sync.Once
+	var dlg dialog.Dialog
+	restoreKeys := func() {}
+	finish := func(val string, ok bool) {
+		once.Do(func() {
+			restoreKeys()
+			ch <- struct {
+				val string
+				ok  bool
+			}{val, ok}
+			dlg.Hide()
+		})
+	}
+	cancel := func() { finish("", false) }
 
+	// order holds the indexes into options in display order; visible is the
+	// subset of order that matches the search box
+	order := make([]int, len(options))
+	for i := range options {
+		order[i] = i
+	}
+	visible := append([]int(nil), order...)
+	list := &activeList{}
+	list.Length = func() int { return len(visible) }
+	list.CreateItem = func() fyne.CanvasObject {
+		row := &listRow{list: list}
+		row.Wrapping = fyne.TextWrapOff
+		row.ExtendBaseWidget(row)
+		return row
+	}
+	// usable is false for releases without the asset; their rows are greyed
+	// out and can't be built
+	usable := func(i int) bool { return rels == nil || hasAsset(rels[i]) }
+	list.UpdateItem = func(id widget.ListItemID, obj fyne.CanvasObject) {
+		row := obj.(*listRow)
+		row.id = id
+		if usable(visible[id]) {
+			row.Importance = widget.MediumImportance
+			row.SetText(options[visible[id]])
+		} else {
+			row.Importance = widget.LowImportance
+			row.SetText(options[visible[id]] + "  —  no " + cfg.AssetName)
+		}
+	}
+	list.ExtendBaseWidget(list)
+
+	// Release actions, enabled once something is selected
+	var relBtns []*widget.Button
 	selected := ""
+	selectedID := -1
+	sizeLabel := widget.NewLabel("")
+	showSize := func() {
+		if rels == nil || selectedID < 0 {
+			sizeLabel.SetText("")
+			return
+		}
+		for _, a := range rels[selectedID].Assets {
+			if a.Name == cfg.AssetName {
+				sizeLabel.SetText(fmt.Sprintf("Size: %s", formatSize(uint64(a.Size))))
+				return
+			}
+		}
+		sizeLabel.SetText("No " + cfg.AssetName)
+	}
 	list.OnSelected = func(id widget.ListItemID) {
-		selected = options[id]
+		selectedID = visible[id]
+		selected = options[selectedID]
+		for _, b := range relBtns {
+			b.Enable()
+		}
+		showSize()
+	}
+	clearSelection := func() {
+		selected, selectedID = "", -1
+		for _, b := range relBtns {
+			b.Disable()
+		}
+		showSize()
+	}
+	if rels != nil {
+		notesBtn := widget.NewButton("View Notes", func() {
+			showNotes(selected, rels[selectedID].Body)
+		})
+		pageBtn := widget.NewButtonWithIcon("Open Release Page", theme.ComputerIcon(), func() {
+			u, err := url.Parse(releasePageURL(rels[selectedID].TagName))
+			if err != nil {
+				return
+			}
+			if err := fyne.CurrentApp().OpenURL(u); err != nil {
+				dialog.ShowError(err, fyneWin)
+			}
+		})
+		copyBtn := widget.NewButtonWithIcon("Copy Download URL", theme.ContentCopyIcon(), func() {
+			fyneApp.Clipboard().SetContent(assetURL(rels[selectedID].TagName))
+		})
+		relBtns = []*widget.Button{notesBtn, pageBtn, copyBtn}
+		for _, b := range relBtns {
+			b.Disable()
+		}
+	}
+	if preselect >= 0 && preselect < len(options) {
+		list.Select(preselect)
+		list.ScrollTo(preselect)
 	}
 
 	scroll := container.NewScroll(list)
-	scroll.SetMinSize(fyne.NewSize(750, 450))
+	scroll.SetMinSize(fyne.NewSize(750, 420))
 
-	var dlg dialog.Dialog
-	buildBtn := widget.NewButton("Build Selected", func() {
-		if selected == "" && len(options) > 0 {
-			selected = options[0]
+	build := func() {
+		id := selectedID
+		if id < 0 && len(visible) > 0 {
+			id = visible[0]
 		}
-		ch <- struct{ val string; ok bool }{selected, selected != ""}
-		dlg.Hide()
-	})
+		if id < 0 {
+			finish("", false)
+			return
+		}
+		if !usable(id) {
+			dialog.ShowInformation("Can't build this version",
+				missingAsset(rels[id])+".\nChoose another version.", fyneWin)
+			return
+		}
+		finish(options[id], true)
+	}
+	list.onActivate = build
+	list.onCancel = cancel
+	buildBtn := widget.NewButton("Build Selected", build)
 	buildBtn.Importance = widget.HighImportance
 
-	cancelBtn := widget.NewButton("Cancel", func() {
-		ch <- struct{ val string; ok bool }{"", false}
-		dlg.Hide()
-	})
+	search := newEscEntry()
+	search.onEscape = cancel
+	search.SetPlaceHolder("Filter by version, tag or date...")
+	refresh := func() {
+		query := strings.ToLower(strings.TrimSpace(search.Text))
+		visible = visible[:0]
+		for _, i := range order {
+			if strings.Contains(strings.ToLower(options[i]), query) {
+				visible = append(visible, i)
+			}
+		}
 
-	content := container.NewBorder(
+		// Keep the selection if it still matches, otherwise clear it
+		keep := selectedID
+		list.UnselectAll()
+		clearSelection()
+		list.Refresh()
+		for pos, i := range visible {
+			if i == keep {
+				list.Select(pos)
+				list.ScrollTo(pos)
+				break
+			}
+		}
+	}
+	search.OnChanged = func(string) { refresh() }
+	search.OnSubmitted = func(string) {
+		if len(visible) != 1 {
+			return
+		}
+		list.Select(0)
+		build()
+	}
+
+	cancelBtn := widget.NewButton("Cancel", cancel)
+
+	buttons := container.NewHBox(cancelBtn, buildBtn)
+	if len(relBtns) > 0 {
+		buttons.Add(layout.NewSpacer())
+		buttons.Add(sizeLabel)
+		for _, b := range relBtns {
+			buttons.Add(b)
+		}
+	}
+
+	top := container.NewVBox(
 		widget.NewLabelWithStyle("Select a version to build:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-		container.NewHBox(cancelBtn, buildBtn),
+		search,
+	)
+	if rels != nil {
+		modes := map[string]string{"Newest first": "date", "Oldest first": "asc", "By version number": "version"}
+		sortSel := widget.NewSelect([]string{"Newest first", "Oldest first", "By version number"}, func(s string) {
+			sort.SliceStable(order, func(i, j int) bool {
+				return release.Less(rels[order[i]], rels[order[j]], modes[s])
+			})
+			refresh()
+		})
+		sortSel.SetSelected("Newest first")
+		top.Objects[1] = container.NewBorder(nil, nil, nil, sortSel, search)
+	}
+
+	content := container.NewBorder(
+		top,
+		buttons,
 		nil, nil,
 		scroll,
 	)
@@ -160,16 +509,184 @@ func askList(title string, options []string) (string, bool) {
 	dlg = dialog.NewCustomWithoutButtons(title, content, fyneWin)
 	dlg.Resize(fyne.NewSize(800, 600))
 	dlg.Show()
+	restoreKeys = dialogKeys(nil, cancel)
+	fyneWin.Canvas().Focus(list)
 
 	result := <-ch
 	return result.val, result.ok
 }
 
+// showNotes shows release notes in a scrollable dialog. Unlike the other
+// dialogs it does not block, so it can be opened from within askList.
+func showNotes(title, body string) {
+	if strings.TrimSpace(body) == "" {
+		body = "(no release notes)"
+	}
+	text := widget.NewLabel(strings.TrimSpace(body))
+	text.Wrapping = fyne.TextWrapWord
+	scroll := container.NewScroll(text)
+	scroll.SetMinSize(fyne.NewSize(650, 400))
+
+	d := dialog.NewCustom(title, "Close", scroll, fyneWin)
+	d.Resize(fyne.NewSize(700, 500))
+	d.Show()
+}
+
+// showResults shows a blocking scrollable list of lines with a Close button.
+func showResults(title, heading string, lines []string) {
+	ch := make(chan struct{}, 1)
+
+	scroll := container.NewScroll(newTextList(lines))
+	scroll.SetMinSize(fyne.NewSize(750, 450))
+
+	var dlg dialog.Dialog
+	closeBtn := widget.NewButton("Close", func() {
+		ch <- struct{}{}
+		dlg.Hide()
+	})
+
+	content := container.NewBorder(
+		widget.NewLabelWithStyle(heading, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		container.NewHBox(closeBtn),
+		nil, nil,
+		scroll,
+	)
+
+	dlg = dialog.NewCustomWithoutButtons(title, content, fyneWin)
+	dlg.Resize(fyne.NewSize(800, 600))
+	dlg.Show()
+	<-ch
+}
+
+// activeList is a widget.List whose rows can be activated (double-click, or
+// Enter on the selected row) as well as selected.
+type activeList struct {
+	widget.List
+	onActivate func()
+	onCancel   func() // Escape
+	keyed      bool   // keyboard focus moved since the last click
+}
+
+// TypedKey activates the focused row on Enter, calls onCancel on Escape and
+// otherwise behaves like widget.List.
+func (l *activeList) TypedKey(ev *fyne.KeyEvent) {
+	switch ev.Name {
+	case fyne.KeyEscape:
+		if l.onCancel != nil {
+			l.onCancel()
+		}
+		return
+	case fyne.KeyReturn, fyne.KeyEnter:
+		if l.keyed {
+			// Space selects the row that has keyboard focus
+			l.List.TypedKey(&fyne.KeyEvent{Name: fyne.KeySpace})
+		}
+		if l.onActivate != nil {
+			l.onActivate()
+		}
+		return
+	case fyne.KeyUp, fyne.KeyDown:
+		l.keyed = true
+	}
+	l.List.TypedKey(ev)
+}
+
+// listRow is an activeList row: a click selects it, a double-click selects
+// and activates it.
+type listRow struct {
+	widget.Label
+	list *activeList
+	id   widget.ListItemID
+}
+
+func (r *listRow) Tapped(*fyne.PointEvent) {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(r.list); c != nil {
+		c.Focus(r.list)
+	}
+	r.list.keyed = false
+	r.list.Select(r.id)
+}
+
+func (r *listRow) DoubleTapped(*fyne.PointEvent) {
+	r.list.keyed = false
+	r.list.Select(r.id)
+	if r.list.onActivate != nil {
+		r.list.onActivate()
+	}
+}
+
+// newTextList builds the single-line label list used by showResults.
+func newTextList(lines []string) *widget.List {
+	return widget.NewList(
+		func() int { return len(lines) },
+		func() fyne.CanvasObject {
+			lbl := widget.NewLabel("")
+			lbl.Wrapping = fyne.TextWrapOff
+			return lbl
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(lines[id])
+		},
+	)
+}
+
 // showError shows a non-blocking error dialog.
 func showError(msg string) {
-	d := dialog.NewError(fmt.Errorf("%s", msg), fyneWin)
-	d.Resize(fyne.NewSize(500, 220))
+	newErrorDialog(msg).Show()
+}
+
+// reportError shows a non-fatal error and records code as the exit status.
+func reportError(code int, msg string) {
+	exitCode.Store(int32(code))
+	showError(msg)
+}
+
+// failBuild shows a fatal error, waits for it to be dismissed and quits
+// with code.
+func failBuild(code int, msg string) {
+	notify("Build Failed", "Build failed: "+strings.SplitN(msg, "\n", 2)[0])
+	ch := make(chan struct{}, 1)
+	d := newErrorDialog(msg)
+	d.SetOnClosed(func() { ch <- struct{}{} })
 	d.Show()
+	<-ch
+	quitWith(code)
+}
+
+// quitWith quits the app; main then exits the process with code.
+func quitWith(code int) {
+	exitCode.Store(int32(code))
+	fyneApp.Quit()
+}
+
+// notify posts a desktop notification unless the "Notify when done" toggle
+// is off. fyne.Do queues it on the main thread without waiting, so the
+// dialogs that follow aren't held up.
+func notify(title, content string) {
+	if !fyneApp.Preferences().BoolWithFallback(prefNotify, true) {
+		return
+	}
+	fyne.Do(func() {
+		fyneApp.SendNotification(fyne.NewNotification(title, content))
+	})
+}
+
+// newErrorDialog builds the error dialog used by showError and failBuild.
+func newErrorDialog(msg string) dialog.Dialog {
+	writeLogFile("error: " + msg)
+	var d dialog.Dialog
+	content := container.NewBorder(nil,
+		container.NewHBox(
+			widget.NewButton("Open Log Folder", openLogFolder),
+			layout.NewSpacer(),
+			widget.NewButton("Close", func() { d.Hide() }),
+		),
+		widget.NewIcon(theme.ErrorIcon()), nil,
+		widget.NewLabel(msg),
+	)
+	d = dialog.NewCustomWithoutButtons("Error", content, fyneWin)
+	d.Resize(fyne.NewSize(500, 220))
+	return d
 }
 
 // showInfo shows a blocking info dialog.
@@ -182,12 +699,41 @@ func showInfo(title, msg string) {
 	<-ch
 }
 
+// showComplete shows the blocking completion dialog with a button to open
+// the log folder. When a digest is given it also offers to copy it to the
+// clipboard.
+func showComplete(msg, digest string) {
+	writeLogFile("complete: " + strings.ReplaceAll(msg, "\n", " "))
+	ch := make(chan struct{}, 1)
+	var d dialog.Dialog
+	buttons := container.NewHBox(widget.NewButton("Open Log Folder", openLogFolder), layout.NewSpacer())
+	if digest != "" {
+		msg = fmt.Sprintf("%s\n\nSHA256: %s", msg, digest)
+		buttons.Add(widget.NewButton("Copy SHA256", func() {
+			fyneApp.Clipboard().SetContent(digest)
+		}))
+	}
+	closeBtn := widget.NewButton("Close", func() { d.Hide() })
+	closeBtn.Importance = widget.HighImportance
+	buttons.Add(closeBtn)
+
+	d = dialog.NewCustomWithoutButtons("Build Complete", container.NewBorder(nil, buttons, nil, nil, widget.NewLabel(msg)), fyneWin)
+	d.SetOnClosed(func() { ch <- struct{}{} })
+	d.Resize(fyne.NewSize(500, 220))
+	d.Show()
+	<-ch
+}
+
 func main() {
-	fyneApp = app.New()
+	fyneApp = app.NewWithID(appID)
 	fyneApp.Settings().SetTheme(theme.DarkTheme())
+	prefs := fyneApp.Preferences()
 
 	fyneWin = fyneApp.NewWindow("REFramework Builder — MH Wilds")
-	fyneWin.Resize(fyne.NewSize(750, 480))
+	fyneWin.Resize(fyne.NewSize(
+		float32(prefs.FloatWithFallback(prefWinWidth, 750)),
+		float32(prefs.FloatWithFallback(prefWinHeight, 480)),
+	))
 	fyneWin.CenterOnScreen()
 	fyneWin.SetFixedSize(false)
 
@@ -206,6 +752,9 @@ func main() {
 	progressBar = widget.NewProgressBar()
 	progressBar.Min = 0
 	progressBar.Max = 1
+	fileLabel = widget.NewLabel("")
+	fileLabel.Truncation = fyne.TextTruncateEllipsis
+	fileLabel.Importance = widget.LowImportance
 
 	// Log area (scrollable)
 	logText = widget.NewLabel("")
@@ -213,110 +762,354 @@ func main() {
 	logScroll := container.NewScroll(logText)
 	logScroll.SetMinSize(fyne.NewSize(700, 200))
 
+	settingsBtn := widget.NewButtonWithIcon("Settings", theme.SettingsIcon(), func() {
+		go editSettings()
+	})
+
+	notifyCheck := widget.NewCheck("Notify when done", func(on bool) {
+		prefs.SetBool(prefNotify, on)
+	})
+	notifyCheck.SetChecked(prefs.BoolWithFallback(prefNotify, true))
+
+	// Profile names come from config.json; a broken file leaves the
+	// built-in ones, and the build itself reports the error
+	c, _ := loadConfig()
+	profileSel := widget.NewSelect(profileNames(c), func(name string) {
+		prefs.SetString(prefProfile, name)
+	})
+	profileSel.SetSelected(prefs.StringWithFallback(prefProfile, defaultProfile))
+	if profileSel.Selected == "" {
+		profileSel.SetSelected(defaultProfile)
+	}
+
+	aboutBtn := widget.NewButtonWithIcon("About", theme.InfoIcon(), func() {
+		dialog.ShowInformation("About", versionString(), fyneWin)
+	})
+
 	content := container.NewVBox(
 		header,
 		subtitle,
+		container.NewHBox(notifyCheck, layout.NewSpacer(), widget.NewLabel("Filters:"), profileSel, aboutBtn, settingsBtn),
 		widget.NewSeparator(),
 		statusLabel,
 		progressBar,
+		fileLabel,
 		widget.NewSeparator(),
 		logScroll,
 	)
 	padded := container.NewPadded(content)
-	fyneWin.SetContent(padded)
+	fyneWin.SetContent(container.New(&sizeSaver{prefs: prefs}, padded))
+
+	// Closing mid-build abandons the build goroutine, so clean up here
+	fyneWin.SetCloseIntercept(func() {
+		cleanupInterrupted()
+		if !buildFinished.Load() {
+			exitCode.Store(exitCancelled)
+		}
+		fyneApp.Quit()
+	})
 
 	// Run the build logic in the background
 	go runBuild()
 
 	fyneWin.ShowAndRun()
+	os.Exit(int(exitCode.Load()))
 }
 
 func runBuild() {
 	defer func() {
 		if r := recover(); r != nil {
-			showError(fmt.Sprintf("Unexpected error: %v", r))
+			failBuild(exitBuild, fmt.Sprintf("Unexpected error: %v", r))
 		}
 	}()
+	if err := openBuildLog(); err != nil {
+		logf(levelError, "Warning: no log file: %v", err)
+	}
 
 	// ── Filters and defaults ──────────────────────────────────────────────────
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		failBuild(exitUsage, fmt.Sprintf("Error reading config:\n%v", err))
+		return
+	}
+	cfg.OutputDir = envOr("OUTPUT_DIR", cfg.OutputDir)
+	cfg.Repo = envOr("REPO", cfg.Repo)
+	cfg.AssetName = envOr("ASSET_NAME", cfg.AssetName)
+	if os.Getenv("VERBOSE") == "1" {
+		verbosity = levelDebug
+	}
+	go func() {
+		if tag, url, ok := checkForUpdate(); ok {
+			logf(levelInfo, "A newer version of this builder is available: %s\n%s", tag, url)
+		}
+	}()
+
+	if moved, err := initCache(); err != nil {
+		logf(levelError, "Warning: could not move %s to %s: %v", legacyCacheDir, cacheDir, err)
+	} else if moved {
+		logf(levelInfo, "Moved %s to %s", legacyCacheDir, cacheDir)
+	}
+
+	if os.Getenv("NO_TEMP_CLEANUP") != "1" {
+		if n, size := workdir.Sweep(time.Hour); n > 0 {
+			logf(levelInfo, "Removed %d stale temp dir(s), reclaimed %s", n, formatSize(size))
+		}
+	}
+
 	devPrefix := os.Getenv("DEV_PREFIX")
-	filters := []string{"RE", "vr", "xr", "VR", "XR", "DELETE", "OpenVR", "OpenXR"}
-	maxList := 20
+	patterns, keepOnly := cfg.Filters, false
+	maxList := cfg.MaxList
 	if v := os.Getenv("MAX_LIST"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			maxList = n
 		}
 	}
 
-	silent := os.Getenv("SILENT") == "1"
-
-	if !silent {
-		val, ok := askEntry("REFramework Build Setup",
-			"How many recent releases to show?",
-			strconv.Itoa(maxList))
-		if !ok {
-			fyneApp.Quit()
+	if v := os.Getenv("KEEP_PATTERNS"); v != "" {
+		patterns, keepOnly = splitPatterns(v), true
+		if len(patterns) == 0 {
+			failBuild(exitUsage, "KEEP_PATTERNS is set but contains no patterns.")
 			return
 		}
-		if n, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && n > 0 {
-			maxList = n
+	}
+	if os.Getenv("KEEP_VR") == "1" {
+		if keepOnly {
+			failBuild(exitUsage, "KEEP_VR and KEEP_PATTERNS can't be combined.")
+			return
+		}
+		// Keeping VR undoes what this tool is for, so ask unless silent
+		if os.Getenv("SILENT") == "1" || askConfirm("Keep VR Files",
+			"KEEP_VR=1 is set: the archive will keep the VR/XR files that are normally removed,\nand be saved with a _full suffix.\n\nBuild the full archive?") {
+			patterns, variantSuffix = nil, "_full"
+			logf(levelInfo, "KEEP_VR: building the full, unfiltered archive.")
 		}
 	}
-
-	// ── Fetch releases ────────────────────────────────────────────────────────
-	setStatus("Fetching recent nightly releases...")
-	setProgress(0.1)
-	showLog("Contacting GitHub API...")
-
-	os.MkdirAll(cacheDir, 0755)
-	etag, _ := os.ReadFile(cacheEtag)
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, _ := http.NewRequest("GET", repoAPI+"?per_page=100", nil)
-	if sEtag := strings.TrimSpace(string(etag)); sEtag != "" {
-		req.Header.Set("If-None-Match", sEtag)
+	replaceFilters, extraFilters := os.Getenv("FILTERS"), os.Getenv("EXTRA_FILTERS")
+	if replaceFilters != "" || extraFilters != "" {
+		if keepOnly || os.Getenv("KEEP_VR") == "1" {
+			failBuild(exitUsage, "FILTERS and EXTRA_FILTERS can't be combined with KEEP_PATTERNS or KEEP_VR.")
+			return
+		}
+		var err error
+		if patterns, err = extendFilters(patterns, replaceFilters, extraFilters); err != nil {
+			failBuild(exitUsage, err.Error())
+			return
+		}
 	}
-
-	resp, err := client.Do(req)
+	filters, err := repack.NewFilterSet(patterns, keepOnly)
 	if err != nil {
-		showError(fmt.Sprintf("Error fetching releases:\n%v", err))
-		fyneApp.Quit()
+		failBuild(exitUsage, err.Error())
 		return
 	}
-	defer resp.Body.Close()
-
-	var releases []Release
-	if resp.StatusCode == http.StatusNotModified {
-		f, err := os.Open(cacheBody)
-		if err == nil {
-			defer f.Close()
-			json.NewDecoder(f).Decode(&releases)
-			showLog("Using cached release data.")
-		}
-	} else if resp.StatusCode == http.StatusOK {
-		data, err := io.ReadAll(resp.Body)
-		if err == nil {
-			if json.Unmarshal(data, &releases) == nil {
-				os.WriteFile(cacheBody, data, 0644)
-				if newEtag := resp.Header.Get("ETag"); newEtag != "" {
-					os.WriteFile(cacheEtag, []byte(newEtag), 0644)
-				}
-				showLog("Fetched fresh release data from GitHub.")
-			}
+	if filters.OnlyDirs, err = parseOnlyDirs(os.Getenv("ONLY_DIRS")); err != nil {
+		failBuild(exitUsage, err.Error())
+		return
+	}
+	if v, ok := os.LookupEnv("ARCHIVE_PREFIX"); ok {
+		if archivePrefix, err = parsePrefix(v); err != nil {
+			failBuild(exitUsage, err.Error())
+			return
 		}
-	} else {
-		if f, err := os.Open(cacheBody); err == nil {
-			defer f.Close()
-			json.NewDecoder(f).Decode(&releases)
-			showLog(fmt.Sprintf("API returned %d, using cached data.", resp.StatusCode))
-		} else {
-			showError(fmt.Sprintf("API returned %d and no cache available.", resp.StatusCode))
-			fyneApp.Quit()
+	}
+	if v := os.Getenv("GAME"); v != "" {
+		if err := applyGame(v); err != nil {
+			failBuild(exitUsage, err.Error())
 			return
 		}
 	}
+	dates, err := release.ParseDateRange("AFTER", os.Getenv("AFTER"), "BEFORE", os.Getenv("BEFORE"))
+	if err != nil {
+		failBuild(exitUsage, err.Error()+".")
+		return
+	}
+	force := os.Getenv("FORCE") == "1"
+	noVerify := os.Getenv("NO_VERIFY") == "1"
+	selectVersion := strings.TrimSpace(os.Getenv("SELECT"))
+	latest := os.Getenv("LATEST") == "1"
+	if latest && selectVersion != "" {
+		failBuild(exitUsage, "LATEST and SELECT both pick a release; use one.")
+		return
+	}
 
-	re := regexp.MustCompile(`^nightly-(\d{4,})-([A-Za-z0-9]+)$`)
-	numMap := make(map[string]Release)
+	keepBuilds := 0
+	if v := os.Getenv("KEEP_BUILDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			failBuild(exitUsage, fmt.Sprintf("KEEP_BUILDS must be a number >= 1, got %q.", v))
+			return
+		}
+		keepBuilds = n
+	}
+	if err := nameScheme().Check(); err != nil {
+		failBuild(exitUsage, fmt.Sprintf("NAME_TEMPLATE: %v", err))
+		return
+	}
+	if keepBuilds > 0 && nameTemplate != naming.DefaultTemplate && strings.Trim(nameScheme().Glob("zip"), "*") == ".zip" {
+		failBuild(exitUsage, fmt.Sprintf("KEEP_BUILDS needs some fixed text in NAME_TEMPLATE to recognise built archives by, got %q.", nameTemplate))
+		return
+	}
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			failBuild(exitUsage, fmt.Sprintf("RATE_LIMIT must be a number of KB/s >= 0, got %q.", v))
+			return
+		}
+		rateLimit = n * 1024
+	}
+	if v := os.Getenv("DOWNLOAD_CHUNKS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 16 {
+			failBuild(exitUsage, fmt.Sprintf("DOWNLOAD_CHUNKS must be a number from 1 to 16, got %q.", v))
+			return
+		}
+		downloadChunks = n
+	}
+	if v := os.Getenv("MIRRORS"); v != "" {
+		cfg.Mirrors = splitPatterns(v)
+	}
+	if v := os.Getenv("MIRROR"); v != "" {
+		cfg.Mirrors = append([]string{v}, cfg.Mirrors...)
+	}
+	for _, m := range cfg.Mirrors {
+		if !strings.HasPrefix(m, "https://") && !strings.HasPrefix(m, "http://") {
+			failBuild(exitUsage, fmt.Sprintf("Mirror %q must be an http:// or https:// URL.", m))
+			return
+		}
+	}
+
+	silent := os.Getenv("SILENT") == "1"
+	dryRunMode := os.Getenv("DRY_RUN") == "1"
+
+	if !silent {
+		val, ok := askEntry("REFramework Build Setup",
+			"How many recent releases to show?",
+			strconv.Itoa(maxList))
+		if !ok {
+			quitWith(exitCancelled)
+			return
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && n > 0 {
+			maxList = n
+		}
+	}
+
+	// Stop now on a folder that can't be written, not after the download
+	if !dryRunMode && os.Getenv("SKIP_DOWNLOAD") != "1" {
+		if err := checkWritable(cfg.OutputDir); err != nil {
+			failBuild(exitBuild, fmt.Sprintf("Error: %v.\nChoose another output folder with OUTPUT_DIR.", err))
+			return
+		}
+	}
+	if err := checkWritable(cacheDir); err != nil {
+		failBuild(exitBuild, fmt.Sprintf("Error: %v.\nPoint CACHE_DIR at a writable folder.", err))
+		return
+	}
+
+	// ── Fetch releases ────────────────────────────────────────────────────────
+	fetchRep := &fyneReporter{}
+	fetchRep.Status("Fetching recent nightly releases...")
+	fetchRep.Progress(0.1)
+	logf(levelInfo, "Contacting GitHub API...")
+
+	os.MkdirAll(cacheDir, 0755)
+	unlockCache := sync.OnceFunc(lockCache())
+	defer unlockCache()
+	var releases []release.Release
+	if cacheReadOnly {
+		// Another instance is refreshing the list; the copy it had will do
+		if cached, err := githubCache.ReadReleases(); err == nil {
+			releases = cached
+			logf(levelInfo, "Another instance is updating the cache; using cached release data.")
+		}
+	}
+	if releases != nil {
+		logf(levelDebug, "cache locked, using %s", githubCache.Releases)
+	} else if resp, err := requestReleases(fetchRep, githubCache.ReadETag()); err != nil {
+		// Out of retries; an old list beats no list
+		cached, cerr := githubCache.ReadReleases()
+		if cerr != nil || downloadCtx.Err() != nil {
+			failBuild(exitNetwork, fmt.Sprintf("Error fetching releases:\n%v", err))
+			return
+		}
+		releases = cached
+		logf(levelError, "Warning: network unavailable (%v),\nusing cached release list from %s.", err, githubCache.FetchTime())
+	} else {
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotModified {
+			if cached, err := githubCache.ReadReleases(); err == nil {
+				logf(levelDebug, "release list cache hit (%s)", githubCache.Releases)
+				if !cacheReadOnly {
+					now := time.Now()
+					os.Chtimes(githubCache.Releases, now, now) // the fetch time -cache-info reports
+				}
+				releases = cached
+				logf(levelInfo, "Using cached release data.")
+			} else {
+				// The ETag outlived the list it stands for; drop it and refetch
+				logf(levelInfo, "Release cache was corrupt, refetching...")
+				logf(levelDebug, "cache read failed: %v", err)
+				if !cacheReadOnly {
+					os.Remove(githubCache.ETag)
+				}
+				if resp, err = requestReleases(fetchRep, ""); err != nil {
+					failBuild(exitNetwork, fmt.Sprintf("Error fetching releases:\n%v", err))
+					return
+				}
+				defer resp.Body.Close()
+			}
+		}
+
+		if resp.StatusCode == http.StatusNotModified {
+			if releases == nil {
+				failBuild(exitNetwork, "API returned 304 without a usable cache.")
+				return
+			}
+		} else if resp.StatusCode == http.StatusOK {
+			logf(levelDebug, "release list cache miss, refreshing %s", githubCache.Releases)
+			data, err := io.ReadAll(resp.Body)
+			if err == nil {
+				releases, err = release.Decode(data)
+			}
+			if err == nil {
+				saveReleases(data, resp.Header.Get("ETag"))
+				logf(levelInfo, "Fetched fresh release data from GitHub.")
+			} else {
+				// Don't overwrite a good cache with it; fall back to that
+				cached, cerr := githubCache.ReadReleases()
+				if cerr != nil {
+					failBuild(exitNetwork, fmt.Sprintf("%v,\nand no usable cache is available (%v).", err, cerr))
+					return
+				}
+				releases = cached
+				logf(levelError, "Warning: %v.\nUsing cached release data.", err)
+			}
+		} else if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+			reason := forbiddenReason(resp)
+			cached, err := githubCache.ReadReleases()
+			if err != nil {
+				failBuild(exitNetwork, fmt.Sprintf("%s,\nand no usable cache is available (%v).", reason, err))
+				return
+			}
+			releases = cached
+			logf(levelError, "Warning: %s.\nUsing cached release data.", reason)
+		} else {
+			cached, err := githubCache.ReadReleases()
+			if err != nil {
+				failBuild(exitNetwork, fmt.Sprintf("API returned %d and no usable cache is available (%v).", resp.StatusCode, err))
+				return
+			}
+			releases = cached
+			logf(levelInfo, "API returned %d, using cached release list from %s.", resp.StatusCode, githubCache.FetchTime())
+		}
+	}
+	unlockCache()
+
+	re := regexp.MustCompile(`^nightly-(\d{4,})-([A-Za-z0-9]+)$`)
+	numMap := make(map[string]release.Release)
+	includePre := os.Getenv("INCLUDE_PRERELEASES") == "1"
+	hiddenPre := 0
+	var otherNums []string // numeric versions DEV_PREFIX left out
 	for _, r := range releases {
 		m := re.FindStringSubmatch(r.TagName)
 		if len(m) == 0 {
@@ -324,6 +1117,14 @@ func runBuild() {
 		}
 		num := m[1]
 		if devPrefix != "" && !strings.HasPrefix(num, devPrefix) {
+			otherNums = append(otherNums, num)
+			continue
+		}
+		if !release.Listable(r, includePre) {
+			logf(levelDebug, "skipping %s (draft %v, prerelease %v, published %v)", r.TagName, r.Draft, r.Prerelease, !r.PublishedAt.IsZero())
+			if release.Listable(r, true) {
+				hiddenPre++
+			}
 			continue
 		}
 		cur, ok := numMap[num]
@@ -334,7 +1135,7 @@ func runBuild() {
 
 	type item struct {
 		Num string
-		Rel Release
+		Rel release.Release
 	}
 	items := make([]item, 0, len(numMap))
 	for k, v := range numMap {
@@ -346,34 +1147,95 @@ func runBuild() {
 
 	setProgress(0.3)
 
-	if len(items) == 0 {
-		showError("Could not find any nightly numeric releases.")
-		fyneApp.Quit()
+	if len(items) == 0 && hiddenPre > 0 {
+		failBuild(exitUsage, fmt.Sprintf("The only matching nightly releases are %d prerelease(s).\nSet INCLUDE_PRERELEASES=1 to offer them.", hiddenPre))
+		return
+	} else if len(items) == 0 && devPrefix != "" && len(otherNums) > 0 {
+		failBuild(exitUsage, fmt.Sprintf("%d releases fetched but none start with prefix %q.\nTry a shorter DEV_PREFIX. Available versions include: %s", len(releases), devPrefix, prefixExamples(otherNums)))
+		return
+	} else if len(items) == 0 && devPrefix != "" {
+		failBuild(exitUsage, fmt.Sprintf("No nightly numeric release matches DEV_PREFIX %q.", devPrefix))
+		return
+	} else if len(items) == 0 {
+		failBuild(exitNetwork, "Could not find any nightly numeric releases.")
 		return
 	}
+	if !dates.IsZero() {
+		inRange := items[:0]
+		for _, it := range items {
+			if dates.Contains(it.Rel.PublishedAt) {
+				inRange = append(inRange, it)
+			}
+		}
+		if len(inRange) == 0 {
+			failBuild(exitUsage, fmt.Sprintf("None of the %d release(s) was published %s.", len(items), dates))
+			return
+		}
+		items = inRange
+	}
 
 	total := len(items)
 	limit := maxList
 	if limit > total {
 		limit = total
 	}
-	showLog(fmt.Sprintf("Found %d numeric nightly version(s). Showing %d.", total, limit))
+	if dates.IsZero() {
+		logf(levelInfo, "Found %d numeric nightly version(s). Showing %d.", total, limit)
+	} else {
+		logf(levelInfo, "Found %d numeric nightly version(s) published %s. Showing %d.", total, dates, limit)
+	}
 
 	// ── Version selection ─────────────────────────────────────────────────────
+	// SELECT wins over silent mode; otherwise silent mode and LATEST take
+	// items[0], the newest release by publish date left after DEV_PREFIX and
+	// BEFORE/AFTER
 	var choice int
-	if silent || maxList == 1 {
+	if selectVersion != "" {
+		rels := make([]release.Release, len(items))
+		for i, it := range items {
+			rels[i] = it.Rel
+		}
+		n, err := release.Pick(rels, 0, selectVersion)
+		if err != nil {
+			failBuild(exitUsage, fmt.Sprintf("SELECT: %v", err))
+			return
+		}
+		choice = n
+		logf(levelInfo, "Selected version %s with SELECT.", items[n-1].Num)
+	} else if silent || latest || limit == 1 {
+		// One candidate, whether from MAX_LIST=1 or filters, is picked
+		// without the list; the existing-archive check still asks unless
+		// FORCE=1
 		choice = 1
+		if devPrefix != "" {
+			logf(levelInfo, "Chose the newest version with DEV_PREFIX %s (%s).", devPrefix, items[0].Num)
+		} else {
+			logf(levelInfo, "Chose the newest version (%s).", items[0].Num)
+		}
 	} else {
 		options := make([]string, 0, limit)
+		rels := make([]release.Release, 0, limit)
 		for i := 0; i < limit; i++ {
 			it := items[i]
 			options = append(options, fmt.Sprintf("%s  (%s)  —  %s",
 				it.Num, it.Rel.TagName, it.Rel.PublishedAt.Format("2006-01-02 15:04 UTC")))
+			rels = append(rels, it.Rel)
+		}
+
+		// Preselect the last built version, or the newest if it's gone
+		preselect := 0
+		last := fyneApp.Preferences().String(prefLastNum)
+		for i := 0; i < limit; i++ {
+			if items[i].Num == last {
+				preselect = i
+				break
+			}
 		}
 
-		selected, ok := askList("Select Version to Build", options)
+		// Sizes and notes load in the background while the list is open
+		selected, ok := askList("Select Version to Build", options, preselect, rels)
 		if !ok {
-			fyneApp.Quit()
+			quitWith(exitCancelled)
 			return
 		}
 		for i, opt := range options {
@@ -387,259 +1249,1919 @@ func runBuild() {
 		}
 	}
 
+	if choice < 1 || choice > len(items) {
+		failBuild(exitUsage, fmt.Sprintf("No release to build (picked %d of %d).", choice, len(items)))
+		return
+	}
 	sel := items[choice-1]
+	if !hasAsset(sel.Rel) {
+		failBuild(exitUsage, missingAsset(sel.Rel)+".\nPick another version.")
+		return
+	}
+	fyneApp.Preferences().SetString(prefLastNum, sel.Num)
 	tag := sel.Rel.TagName
 	pubDate := sel.Rel.PublishedAt
 
-	m2 := re.FindStringSubmatch(tag)
-	version := tag
-	if len(m2) == 3 {
-		shortHash := m2[2]
-		if len(shortHash) > 6 {
-			shortHash = shortHash[:6]
+	nf := naming.ReleaseFields(tag, pubDate)
+	version := nf.Version
+	// The profile dropdown may have changed while the version list was
+	// open, so read it only now. KEEP_PATTERNS, KEEP_VR and FILTERS take
+	// precedence; EXTRA_FILTERS is added to the profile's patterns.
+	if !keepOnly && variantSuffix == "" && replaceFilters == "" {
+		name := fyneApp.Preferences().StringWithFallback(prefProfile, defaultProfile)
+		patterns, err := profileFilters(cfg, name)
+		if err != nil {
+			failBuild(exitUsage, err.Error())
+			return
+		}
+		if patterns, err = extendFilters(patterns, "", extraFilters); err != nil {
+			failBuild(exitUsage, err.Error())
+			return
+		}
+		onlyDirs := filters.OnlyDirs
+		if filters, err = repack.NewFilterSet(patterns, false); err != nil {
+			failBuild(exitUsage, fmt.Sprintf("Profile %s: %v", name, err))
+			return
 		}
-		version = fmt.Sprintf("nightly-%s-%s", m2[1], shortHash)
+		filters.OnlyDirs = onlyDirs
+		if name != defaultProfile {
+			variantSuffix = "_" + name
+			logf(levelInfo, "Filter profile %s (%s)", name, filters)
+		}
+	}
+	logf(levelDebug, "effective filters: %s", filters)
+	name, err := nameScheme().Name(nf)
+	if err != nil {
+		failBuild(exitUsage, err.Error())
+		return
 	}
-	finalZip := fmt.Sprintf("REFramework_%s_%s.zip", version, pubDate.Format("02Jan06"))
-	showLog(fmt.Sprintf("Selected: %s → %s", tag, finalZip))
+	finalZip := filepath.Join(cfg.OutputDir, name)
+	logf(levelInfo, "Selected: %s → %s", tag, finalZip)
 
 	// ── Check if output exists ────────────────────────────────────────────────
-	if _, err := os.Stat(finalZip); err == nil {
-		if !silent {
-			ok := askConfirm("Archive Exists",
-				fmt.Sprintf("%s already exists.\nRebuild it anyway?", finalZip))
+	exists := false
+	if _, err := os.Stat(finalZip); err == nil && !dryRunMode {
+		// A damaged archive is rebuilt without asking whether to skip it
+		if err := checkExisting(finalZip, os.Getenv("VERIFY_EXISTING") == "1"); err != nil {
+			logf(levelError, "Warning: the existing %s is damaged (%v); rebuilding it.", finalZip, err)
+		} else {
+			exists = true
+		}
+	}
+	if exists {
+		upToDate := sourceUnchanged(finalZip, sel.Rel, filters)
+		if force {
+			logf(levelInfo, "FORCE=1: rebuilding the existing archive.")
+		} else if upToDate && silent {
+			logf(levelInfo, "✓ %s is up to date (source unchanged).", finalZip)
+			setStatus("Up to date ✓")
+			setProgress(1.0)
+			quitWith(exitOK)
+			return
+		}
+		if !silent && !force {
+			msg := fmt.Sprintf("%s already exists.\nRebuild it anyway?", finalZip)
+			if upToDate {
+				msg = fmt.Sprintf("%s is up to date: it was built from the same\nsource with the same filters.\nRebuild it anyway?", finalZip)
+			}
+			ok := askConfirm("Archive Exists", msg)
 			if !ok {
 				setStatus("Cancelled.")
 				showInfo("Cancelled", "Build cancelled. Archive already exists.")
-				fyneApp.Quit()
+				quitWith(exitCancelled)
 				return
 			}
 		}
 	}
 
 	// ── Temp workspace ────────────────────────────────────────────────────────
-	tmpDir, err := os.MkdirTemp("", "reframework-build-*")
+	tmpDir, err := workdir.Create("build")
 	if err != nil {
-		showError(fmt.Sprintf("Error creating temp dir:\n%v", err))
-		fyneApp.Quit()
+		failBuild(exitBuild, fmt.Sprintf("Error creating temp dir:\n%v", err))
 		return
 	}
 	defer os.RemoveAll(tmpDir)
+	removeOnInterrupt(tmpDir)
+	defer keepOnInterrupt(tmpDir)
 
 	stagingZip := filepath.Join(tmpDir, zipName)
-	stagingFinal := filepath.Join(tmpDir, finalZip)
+	var stats repack.Stats
 
 	// ── Download ──────────────────────────────────────────────────────────────
 	if os.Getenv("SKIP_DOWNLOAD") == "1" {
-		showLog("SKIP_DOWNLOAD=1: skipping download.")
-		goto finalize
+		summary := fmt.Sprintf("Selected tag: %s\nVersion: %s\nDownload URL: %s\nWould create: %s\nFilters: %s",
+			tag, version, assetURL(tag), finalZip, filters)
+		logf(levelInfo, "SKIP_DOWNLOAD=1: test mode, nothing downloaded.\n%s", summary)
+		setStatus("Test mode ✓")
+		showInfo("Test Mode", summary)
+		quitWith(exitOK)
+		return
 	}
 
 	{
-		setStatus(fmt.Sprintf("Downloading %s...", tag))
-		setProgress(0.0)
-		showLog(fmt.Sprintf("Downloading from GitHub releases (%s)...", tag))
-
-		url := fmt.Sprintf("https://github.com/praydog/REFramework-nightly/releases/download/%s/MHWILDS.zip", tag)
-		resp2, err := http.Get(url)
-		if err != nil {
-			showError(fmt.Sprintf("Error downloading:\n%v", err))
-			fyneApp.Quit()
-			return
-		}
-		defer resp2.Body.Close()
-
-		if resp2.StatusCode != http.StatusOK {
-			showError(fmt.Sprintf("Download failed: HTTP %s", resp2.Status))
-			fyneApp.Quit()
-			return
+		dlRep := &fyneReporter{}
+		dlRep.Status(fmt.Sprintf("Downloading %s...", tag))
+		dlRep.Progress(0)
+		if len(cfg.Mirrors) > 0 {
+			logf(levelInfo, "Downloading %s (%d mirror(s), then GitHub releases)...", tag, len(cfg.Mirrors))
+		} else {
+			logf(levelInfo, "Downloading from GitHub releases (%s)...", tag)
 		}
 
-		out, err := os.Create(stagingZip)
-		if err != nil {
-			showError(fmt.Sprintf("Error creating staging file:\n%v", err))
-			fyneApp.Quit()
+		if err := downloadAsset(tag, stagingZip, dlRep); err != nil {
+			os.Remove(stagingZip)
+			failBuild(exitNetwork, fmt.Sprintf("Error downloading:\n%v", err))
 			return
 		}
+		logf(levelInfo, "Download complete.")
+	}
 
-		pr := &ProgressReader{
-			Reader: resp2.Body,
-			Total:  resp2.ContentLength,
-			OnProgress: func(pct float64) {
-				setProgress(pct)
-			},
+	if len(filters.OnlyDirs) > 0 {
+		if names, err := topLevelNames(stagingZip); err == nil {
+			logf(levelInfo, "Top-level entries in the download: %s", strings.Join(names, ", "))
+			for _, d := range filters.OnlyDirs {
+				if !slices.Contains(names, d) {
+					logf(levelError, "Warning: ONLY_DIRS entry %s is not in the download.", d)
+				}
+			}
 		}
-		_, err = io.Copy(out, pr)
-		out.Close()
+	}
 
+	// ── Dry run ───────────────────────────────────────────────────────────────
+	if dryRunMode {
+		lines, summary, err := dryRun(stagingZip, filters)
 		if err != nil {
-			showError(fmt.Sprintf("Error saving download:\n%v", err))
-			fyneApp.Quit()
+			failBuild(exitBuild, fmt.Sprintf("Error reading download:\n%v", err))
 			return
 		}
-		showLog("Download complete.")
+		setStatus("Dry run complete.")
+		setProgress(1.0)
+		logf(levelInfo, "%s", summary)
+		showResults("Dry Run — "+tag, summary, lines)
+		fyneApp.Quit()
+		return
 	}
 
 	// ── Transcode ─────────────────────────────────────────────────────────────
 	setStatus("Creating optimized archive (removing VR/XR files)...")
 	setProgress(0.0)
-	showLog("Transcoding: filtering VR/XR files and repacking...")
+	logf(levelInfo, "Transcoding: filtering VR/XR files and repacking...")
 
-	if err := transcodeZip(stagingZip, stagingFinal, filters, func(pct float64) {
-		setProgress(pct)
-	}); err != nil {
-		showError(fmt.Sprintf("Error creating archive:\n%v", err))
-		fyneApp.Quit()
+	// Build next to finalZip and rename it into place once complete: no
+	// second copy of the archive, and a failed rebuild keeps the old one
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		failBuild(exitBuild, fmt.Sprintf("Error creating output dir:\n%v", err))
 		return
 	}
-	showLog("Archive created successfully.")
-
-	// ── Move to working directory ─────────────────────────────────────────────
-	if err := copyFile(stagingFinal, finalZip); err != nil {
-		showError(fmt.Sprintf("Error saving final archive:\n%v", err))
-		fyneApp.Quit()
+	partial := finalZip + ".partial"
+	removeOnInterrupt(partial)
+	defer keepOnInterrupt(partial)
+	rep := &fyneReporter{}
+	stats, err = transcodeZip(downloadCtx, rep, stagingZip, partial, filters, newBuildMeta(tag, "", pubDate, filters))
+	setCurrentFile("")
+	if err == nil && !noVerify {
+		// Catch a truncated or corrupt write (a full disk, say) before it
+		// replaces the previous archive
+		rep.Status("Verifying archive...")
+		if verr := testArchive(downloadCtx, partial); verr != nil {
+			err = fmt.Errorf("built archive failed verification: %w", verr)
+		}
+	}
+	if err == nil {
+		err = os.Rename(partial, finalZip)
+	}
+	if err != nil {
+		os.Remove(partial)
+		failBuild(exitBuild, fmt.Sprintf("Error creating archive:\n%v", err)+rescueDownload(stagingZip, sel.Rel)+preservedNote(finalZip))
 		return
 	}
+	logf(levelInfo, "Archive created successfully.")
+	logf(levelInfo, "Kept %d file(s), removed %d.", stats.Kept, stats.Removed)
+
+	writeSourceStamp(finalZip, sel.Rel, filters)
+	if os.Getenv("KEEP_DOWNLOAD") == "1" {
+		if kept, err := saveDownload(stagingZip, sel.Rel); err != nil {
+			logf(levelError, "Warning: could not keep the download: %v", err)
+		} else {
+			logf(levelInfo, "Kept the download as %s", kept)
+		}
+	}
+	notify("Build Complete", "Built "+filepath.Base(finalZip))
 
-finalize:
+	buildFinished.Store(true)
 	if _, err := os.Stat(finalZip); err != nil {
-		showError(fmt.Sprintf("Critical: Final archive not found!\n%s", finalZip))
-		fyneApp.Quit()
+		failBuild(exitBuild, fmt.Sprintf("Critical: Final archive not found!\n%s", finalZip))
 		return
 	}
 
 	setStatus("Build complete ✓")
 	setProgress(1.0)
-	showLog(fmt.Sprintf("✓ Done: %s", finalZip))
+	logf(levelInfo, "✓ Done: %s", finalZip)
+
+	details := ""
+	if fi, err := os.Stat(finalZip); err == nil && stats.Kept > 0 {
+		sizes := sizeSummary(stats.Uncompressed, uint64(fi.Size()), stats.Kept)
+		logf(levelInfo, "%s", sizes)
+		details = "\n\n" + sizes
+	}
+	if info := release.Info(tag, pubDate); info != "" {
+		logf(levelInfo, "%s", info)
+		details = "\n\n" + info + details
+	}
+
+	digest := ""
+	if os.Getenv("WRITE_CHECKSUM") == "1" {
+		if digest, err = writeChecksum(finalZip); err != nil {
+			reportError(exitBuild, fmt.Sprintf("Error writing checksum:\n%v", err))
+		} else {
+			logf(levelInfo, "SHA256: %s (%s.sha256)", digest, finalZip)
+		}
+	}
+
+	if keepBuilds > 0 {
+		removed, err := nameScheme().Prune(filepath.Dir(finalZip), keepBuilds, finalZip)
+		for _, p := range removed {
+			logf(levelInfo, "Pruned old archive: %s", p)
+		}
+		if err != nil {
+			reportError(exitBuild, fmt.Sprintf("Error pruning archives:\n%v", err))
+		}
+	}
+
+	// ── Install into the game folder ──────────────────────────────────────────
+	if os.Getenv("INSTALL") == "1" {
+		installToGame(finalZip)
+	}
 
 	// ── Offer to copy to Downloads ────────────────────────────────────────────
-	home, err := os.UserHomeDir()
-	if err == nil {
-		winDownloads := filepath.Join(home, "Downloads")
-		if _, err := os.Stat(winDownloads); err == nil {
-			dest := filepath.Join(winDownloads, finalZip)
-			if silent {
-				atomicCopy(finalZip, dest)
-				showLog(fmt.Sprintf("Copied to Downloads: %s", finalZip))
+	winDownloads, err := downloadsDir()
+	if err != nil {
+		logf(levelError, "Warning: not copying to Downloads: %v", err)
+	}
+	if winDownloads == "" || err != nil || os.Getenv("NO_DOWNLOADS_COPY") == "1" {
+		showComplete(fmt.Sprintf("Build complete!\nSaved as %s", finalZip)+details, digest)
+	} else {
+		dest := filepath.Join(winDownloads, filepath.Base(finalZip))
+		if silent {
+			if err := atomicCopy(finalZip, dest); err == nil {
+				logf(levelInfo, "Copied to Downloads: %s", dest)
 			} else {
-				ok := askConfirm("Copy to Downloads",
-					fmt.Sprintf("Copy %s to your Downloads folder?", finalZip))
-				if ok {
-					if err := atomicCopy(finalZip, dest); err == nil {
-						showLog("✓ Copied to Downloads folder.")
-						showInfo("Build Complete", fmt.Sprintf("Successfully built and copied:\n%s", finalZip))
-					} else {
-						showError(fmt.Sprintf("Error copying to Downloads:\n%v", err))
-					}
-				} else {
-					showInfo("Build Complete", fmt.Sprintf("Build complete!\n%s is in the current directory.", finalZip))
-				}
+				logf(levelError, "Warning: could not copy to Downloads: %v\nThe archive is still at %s", err, absPath(finalZip))
+			}
+		} else if askConfirm("Copy to Downloads", fmt.Sprintf("Copy %s to your Downloads folder?", finalZip)) {
+			if err := atomicCopy(finalZip, dest); err == nil {
+				logf(levelInfo, "✓ Copied to Downloads folder.")
+				showComplete(fmt.Sprintf("Successfully built and copied:\n%s", finalZip)+details, digest)
+			} else {
+				logf(levelError, "Warning: could not copy to Downloads: %v", err)
+				showComplete(fmt.Sprintf("Build complete, but copying to Downloads failed:\n%v\n\nThe archive is at %s", err, absPath(finalZip))+details, digest)
 			}
 		} else {
-			showInfo("Build Complete", fmt.Sprintf("Build complete!\n%s is in the current directory.", finalZip))
+			showComplete(fmt.Sprintf("Build complete!\nSaved as %s", finalZip)+details, digest)
 		}
 	}
 
 	fyneApp.Quit()
 }
 
+// installToGame extracts finalZip into the game folder (GAME_DIR, or the
+// detected Steam install) after the user confirms.
+func installToGame(finalZip string) {
+	if game != defaultGame {
+		showError(fmt.Sprintf("Install skipped:\nINSTALL only knows Monster Hunter Wilds, not GAME=%s", game))
+		return
+	}
+	gameDir := os.Getenv("GAME_DIR")
+	if gameDir == "" {
+		var err error
+		if gameDir, err = install.FindGameDir(); err != nil {
+			showError(fmt.Sprintf("Install skipped:\n%v", err))
+			return
+		}
+	} else if !install.IsGameDir(gameDir) {
+		showError(fmt.Sprintf("Install skipped:\n%s not found in %s", install.GameExe, gameDir))
+		return
+	}
+
+	if !askConfirm("Install REFramework",
+		fmt.Sprintf("Extract %s into\n%s?\n\nFiles that would be overwritten are backed up first.", filepath.Base(finalZip), gameDir)) {
+		logf(levelInfo, "Install skipped.")
+		return
+	}
+
+	setStatus("Installing into game folder...")
+	written, backedUp, backupDir, err := install.Archive(finalZip, gameDir, prefixed(""), metaName())
+	for _, p := range written {
+		logf(levelInfo, "Installed: %s", p)
+	}
+	if err != nil {
+		reportError(exitBuild, fmt.Sprintf("Error installing into game folder:\n%v", err))
+		return
+	}
+	msg := fmt.Sprintf("✓ Installed %d file(s) into %s", len(written), gameDir)
+	if len(backedUp) > 0 {
+		msg += fmt.Sprintf("; backed up %d to %s", len(backedUp), backupDir)
+	}
+	logf(levelInfo, "%s", msg)
+	setStatus("Build complete ✓")
+}
+
+// atomicCopy copies the finished archive to the Downloads folder, showing
+// the copy on the progress bar. Copying a file onto itself is a no-op.
 func atomicCopy(src, dst string) error {
 	absSrc, _ := filepath.Abs(src)
 	absDst, _ := filepath.Abs(dst)
 	if absSrc == absDst {
 		return nil
 	}
-	return copyFile(src, dst)
+	rep := &fyneReporter{}
+	rep.Status("Copying to Downloads…")
+	rep.Progress(0)
+	// Copy next to dst and rename, so a failed copy never leaves a truncated
+	// archive (or a clobbered older copy) in Downloads
+	tmp := dst + ".part"
+	err := copyFile(src, tmp, &ProgressReader{Rep: rep})
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	setProgress(1.0)
+	setStatus("Build complete ✓")
+	return err
 }
 
-func transcodeZip(src, dest string, filters []string, onProgress func(float64)) error {
-	sReader, err := zip.OpenReader(src)
+// checkExisting tells whether the archive an earlier run left at finalZip
+// can still be read, since an interrupted run or a full disk can leave one
+// that can't. It reads the zip's central directory and, with full, every
+// entry's data and checksum too.
+func checkExisting(finalZip string, full bool) error {
+	if full {
+		return testArchive(downloadCtx, finalZip)
+	}
+	r, err := zip.OpenReader(finalZip)
 	if err != nil {
-		return fmt.Errorf("open source: %w", err)
+		return err
 	}
-	defer sReader.Close()
+	return r.Close()
+}
 
-	dFile, err := os.Create(dest)
+// testArchive reads every entry of the zip at path to the end, the way
+// unzip -t does, so a truncated file or a bad checksum turns into an error.
+func testArchive(ctx context.Context, path string) error {
+	r, err := zip.OpenReader(path)
 	if err != nil {
-		return fmt.Errorf("create dest: %w", err)
+		return err
 	}
-	defer dFile.Close()
+	defer r.Close()
+	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
 
-	dWriter := zip.NewWriter(dFile)
-	defer dWriter.Close()
+// preservedNote is appended to a build error when an earlier archive of the
+// same name survived the failed rebuild.
+func preservedNote(finalZip string) string {
+	if _, err := os.Stat(finalZip); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("\n\nThe previous archive %s was preserved.", finalZip)
+}
 
-	_, err = dWriter.Create("MHWILDS/")
+// saveDownload moves the downloaded asset src of rel into the output dir as
+// <tag>_<date>_<asset>, a name -input turns back into the usual archive
+// name, and returns its path.
+func saveDownload(src string, rel release.Release) (string, error) {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return "", err
+	}
+	name := rel.TagName + "_" + rel.PublishedAt.Format("02Jan06") + "_" + cfg.AssetName
+	dst := filepath.Join(cfg.OutputDir, name)
+	if os.Rename(src, dst) == nil {
+		return dst, nil
+	}
+	// The temp dir is often on another volume; copy through a .part file
+	tmp := dst + ".part"
+	err := copyFile(src, tmp, nil)
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
 	if err != nil {
-		return fmt.Errorf("create root dir: %w", err)
+		os.Remove(tmp)
+		return "", err
 	}
+	return dst, nil
+}
 
-	totalFiles := len(sReader.File)
-	processedFiles := 0
+// rescueDownload keeps the download after a failed build, so it can be
+// looked at or rebuilt from without fetching it again, and returns a note
+// for the error message saying where it went. Nothing is kept after an
+// interrupt.
+func rescueDownload(src string, rel release.Release) string {
+	if downloadCtx.Err() != nil {
+		return ""
+	}
+	kept, err := saveDownload(src, rel)
+	if err != nil {
+		return fmt.Sprintf("\n\nThe download could not be kept: %v", err)
+	}
+	return fmt.Sprintf("\n\nThe download was kept as %s.\nRebuild from it with the CLI builder's -input.", kept)
+}
 
-	for _, f := range sReader.File {
-		processedFiles++
-		if onProgress != nil {
-			onProgress(float64(processedFiles) / float64(totalFiles))
-		}
+// downloadsDir returns the user's Downloads folder, or "" if there is none.
+// A folder that exists but can't be written to is returned with an error,
+// so the copy isn't offered only to fail after the build.
+func downloadsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	dir := filepath.Join(home, "Downloads")
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", nil
+	}
+	probe, err := os.CreateTemp(dir, ".reframework-builder-*")
+	if err != nil {
+		return dir, fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return dir, nil
+}
 
-		skip := false
-		for _, p := range filters {
-			if strings.Contains(f.Name, p) {
-				skip = true
-				break
-			}
-		}
-		if skip {
-			continue
-		}
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
 
-		srcFile, err := f.Open()
-		if err != nil {
-			return fmt.Errorf("open entry %s: %w", f.Name, err)
-		}
+// zipComment is the comment of an output zip: ZIP_COMMENT if set, otherwise
+// a line saying what the archive was built from, followed by the source
+// zip's own comment.
+func zipComment(src, srcComment string, meta *buildMeta) string {
+	if c := os.Getenv("ZIP_COMMENT"); c != "" {
+		return c
+	}
+	from := filepath.Base(src)
+	if meta != nil && meta.SourceTag != "" {
+		from = meta.SourceTag
+	}
+	c := fmt.Sprintf("Built by REFramework Builder %s from %s on %s", builderVersion, from, time.Now().UTC().Format("2006-01-02"))
+	if srcComment != "" {
+		c += "\n" + srcComment
+	}
+	return c
+}
 
-		header := &zip.FileHeader{
-			Name:     "MHWILDS/" + f.Name,
-			Method:   zip.Deflate,
-			Modified: f.Modified,
-		}
-		destFile, err := dWriter.CreateHeader(header)
-		if err != nil {
-			srcFile.Close()
-			return fmt.Errorf("create header %s: %w", f.Name, err)
-		}
+// sourceRootDir is the folder some source zips already wrap everything in:
+// the game's name.
+var sourceRootDir = defaultGame + "/"
 
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
-		if err != nil {
-			return fmt.Errorf("copy entry %s: %w", f.Name, err)
+// archivePrefix is the folder every output entry is placed under
+// (ARCHIVE_PREFIX). Empty puts the entries at the top level of the archive.
+var archivePrefix = "MHWILDS"
+
+// prefixed returns rel placed under archivePrefix.
+func prefixed(rel string) string {
+	if archivePrefix == "" {
+		return rel
+	}
+	return archivePrefix + "/" + rel
+}
+
+// parsePrefix validates an ARCHIVE_PREFIX value: a relative slash-separated
+// folder path, or empty for none.
+func parsePrefix(s string) (string, error) {
+	p := strings.Trim(s, "/")
+	if p == "" {
+		return "", nil
+	}
+	if strings.Contains(p, `\`) {
+		return "", fmt.Errorf("ARCHIVE_PREFIX must use forward slashes, got %q.", s)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("ARCHIVE_PREFIX must be a plain folder path, got %q.", s)
 		}
 	}
+	return p, nil
+}
 
-	if err := dWriter.Close(); err != nil {
-		return fmt.Errorf("close zip writer: %w", err)
+// openZip opens a source zip with its entry names normalized by
+// repack.NormalizeNames.
+func openZip(path string) (*zip.ReadCloser, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
 	}
+	repack.NormalizeNames(r.File)
+	return r, nil
+}
 
-	return nil
+// sourceRoot returns sourceRootDir if every entry of a source zip is already
+// under it, so it can be stripped instead of being prefixed a second time
+// (MHWILDS/MHWILDS/...). Otherwise it returns "".
+func sourceRoot(files []*zip.File) string {
+	return repack.SourceRoot(files, sourceRootDir)
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+// ioBufSize is the buffer on both ends of an archive copy, so large entries
+// move in a few big reads and writes instead of many small syscalls.
+const ioBufSize = 1 << 20
+
+// transcodeZip writes the entries of src kept by filters to dest under the
+// archive prefix, reporting its progress entry by entry to rep. It checks
+// ctx before each entry and returns ctx.Err() once it is cancelled.
+func transcodeZip(ctx context.Context, rep report.Reporter, src, dest string, filters repack.FilterSet, meta *buildMeta) (repack.Stats, error) {
+	transcoding.Add(1)
+	defer transcoding.Add(-1)
+	sReader, err := openZip(src)
 	if err != nil {
-		return err
+		return repack.Stats{}, fmt.Errorf("open source: %w", err)
 	}
-	defer in.Close()
+	defer sReader.Close()
 
-	out, err := os.Create(dst)
+	dFile, err := os.Create(dest)
+	if err != nil {
+		return repack.Stats{}, fmt.Errorf("create dest: %w", err)
+	}
+	defer dFile.Close()
+
+	root := sourceRoot(sReader.File)
+	keep := func(f *zip.File) bool {
+		drop, rule := filters.Match(strings.TrimPrefix(f.Name, root))
+		if drop {
+			logf(levelDebug, "filtered out: %s (%s)", f.Name, rule)
+		}
+		return !drop
+	}
+	opts := repack.Options{
+		Prefix:     archivePrefix,
+		SourceRoot: sourceRootDir,
+		Comment:    zipComment(src, sReader.Comment, meta),
+		Reporter:   rep,
+	}
+	if meta != nil {
+		opts.MetaName = metaFile
+		opts.MetaData = func(stats repack.Stats) ([]byte, error) { return metaJSON(meta, stats) }
+	}
+	stats, err := repack.Zip(ctx, &sReader.Reader, dFile, keep, opts)
+	if errors.Is(err, repack.ErrEmptyArchive) {
+		dFile.Close()
+		os.Remove(dest)
+	}
+	if err != nil {
+		return stats, err
+	}
+	return stats, dFile.Close()
+}
+
+// variantSuffix is appended to output names that aren't the usual stripped
+// build: "_full" with -keep-vr.
+var variantSuffix string
+
+// game is the nightly asset being built (-game), and gameSuffix what goes
+// before variantSuffix in output names: "_<game>" for any game but the
+// default, so builds of different games don't share a name.
+var (
+	game       = defaultGame
+	gameSuffix string
+)
+
+// gameNameRe matches a -game value: an asset name without its extension.
+var gameNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// nameTemplate names built archives (NAME_TEMPLATE); see naming.Scheme.Name.
+var nameTemplate = envOr("NAME_TEMPLATE", naming.DefaultTemplate)
+
+// nameScheme is how this run names its archives: nameTemplate with the
+// archive prefix and variant suffix it is run with.
+func nameScheme() naming.Scheme {
+	return naming.Scheme{Template: nameTemplate, Prefix: archivePrefix, Variant: gameSuffix + variantSuffix}
+}
+
+// ruleCounts lists how many entries each rule dropped as "count  rule"
+// lines, the rule that dropped the most first.
+func ruleCounts(counts map[string]int) []string {
+	rules := make([]string, 0, len(counts))
+	for r := range counts {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	lines := make([]string, len(rules))
+	for i, r := range rules {
+		lines[i] = fmt.Sprintf("%5d  %s", counts[r], r)
+	}
+	return lines
+}
+
+// parseOnlyDirs parses the comma-separated -only-dirs list. Each name must
+// be a single top-level file or folder of the source archive.
+func parseOnlyDirs(s string) ([]string, error) {
+	var dirs []string
+	for _, d := range splitPatterns(s) {
+		name := strings.Trim(d, "/")
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("-only-dirs takes top-level names, got %q", d)
+		}
+		dirs = append(dirs, name)
+	}
+	return dirs, nil
+}
+
+// topLevelNames lists the distinct top-level files and folders in a zip.
+func topLevelNames(src string) ([]string, error) {
+	r, err := openZip(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var names []string
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		top, _, _ := strings.Cut(strings.TrimPrefix(f.Name, root), "/")
+		if top != "" && !slices.Contains(names, top) {
+			names = append(names, top)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// extendFilters applies FILTERS/-filters and EXTRA_FILTERS/-exclude to an
+// exclude list: replace, if set, takes the place of patterns, and extra is
+// appended to the result. Either one being set but holding no patterns is
+// an error.
+func extendFilters(patterns []string, replace, extra string) ([]string, error) {
+	if replace != "" {
+		if patterns = splitPatterns(replace); len(patterns) == 0 {
+			return nil, errors.New("-filters (FILTERS) contains no patterns")
+		}
+	}
+	if extra != "" {
+		more := splitPatterns(extra)
+		if len(more) == 0 {
+			return nil, errors.New("-exclude (EXTRA_FILTERS) contains no patterns")
+		}
+		// A fresh slice, so the config's list isn't appended to in place
+		patterns = append(append([]string(nil), patterns...), more...)
+	}
+	return patterns, nil
+}
+
+// splitPatterns parses a comma-separated pattern list, dropping blanks.
+func splitPatterns(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// dryRun lists which entries of src the filters would keep and remove. It
+// returns one display line per file (kept first) and a totals summary.
+func dryRun(src string, filters repack.FilterSet) ([]string, string, error) {
+	r, err := openZip(src)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	var kept, removed []string
+	var keptSize, removedSize uint64
+	byRule := make(map[string]int)
+	root := sourceRoot(r.File)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.TrimPrefix(f.Name, root)
+		line := fmt.Sprintf("%s  (%s)", name, formatSize(f.UncompressedSize64))
+		if drop, rule := filters.Match(name); drop {
+			removed = append(removed, "REMOVED  "+line+"  ["+rule+"]")
+			removedSize += f.UncompressedSize64
+			byRule[rule]++
+		} else {
+			kept = append(kept, "KEPT     "+line)
+			keptSize += f.UncompressedSize64
+		}
+	}
+
+	summary := fmt.Sprintf("Kept: %d file(s), %s | Removed: %d file(s), %s",
+		len(kept), formatSize(keptSize), len(removed), formatSize(removedSize))
+	lines := append(kept, removed...)
+	if len(byRule) > 0 {
+		lines = append(lines, "", "Removed by rule:")
+		lines = append(lines, ruleCounts(byRule)...)
+	}
+	return lines, summary, nil
+}
+
+// sizeSummary formats the size line shown after a build.
+func sizeSummary(uncompressed, compressed uint64, files int) string {
+	ratio := 0.0
+	if uncompressed > 0 {
+		ratio = float64(compressed) * 100 / float64(uncompressed)
+	}
+	return fmt.Sprintf("Uncompressed: %s, Compressed: %s (%.1f%% ratio), Files: %d",
+		formatSize(uncompressed), formatSize(compressed), ratio, files)
+}
+
+// formatSize renders a byte count as a human-readable string.
+func formatSize(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// prefixExamples lists a few of the numeric versions DEV_PREFIX left out,
+// highest first, for the error when it leaves out every release.
+func prefixExamples(nums []string) string {
+	sort.Slice(nums, func(i, j int) bool {
+		if len(nums[i]) != len(nums[j]) {
+			return len(nums[i]) > len(nums[j])
+		}
+		return nums[i] > nums[j]
+	})
+	if len(nums) > 5 {
+		nums = nums[:5]
+	}
+	return strings.Join(nums, ", ")
+}
+
+// hasAsset reports whether rel offers the configured asset for download.
+// Nightlies older than a game's support don't.
+func hasAsset(rel release.Release) bool {
+	for _, a := range rel.Assets {
+		if a.Name == cfg.AssetName {
+			return true
+		}
+	}
+	return false
+}
+
+// applyGame switches the build to another game in the nightly releases:
+// <name>.zip is downloaded and its entries go under <name>/, unless the
+// asset or the prefix was set to something else explicitly.
+func applyGame(name string) error {
+	name = strings.TrimSuffix(name, ".zip")
+	if name == defaultGame {
+		return nil
+	}
+	if !gameNameRe.MatchString(name) {
+		return fmt.Errorf("-game must be an asset name such as RE4 or DMC5, got %q", name)
+	}
+	if cfg.AssetName == zipName {
+		cfg.AssetName = name + ".zip"
+	}
+	if archivePrefix == defaultGame {
+		archivePrefix = name
+	}
+	game, gameSuffix, sourceRootDir = name, "_"+name, name+"/"
+	return nil
+}
+
+// releaseGames returns the games rel has a zip for, sorted.
+func releaseGames(rel release.Release) []string {
+	var games []string
+	for _, a := range rel.Assets {
+		if name, ok := strings.CutSuffix(a.Name, ".zip"); ok {
+			games = append(games, name)
+		}
+	}
+	sort.Strings(games)
+	return games
+}
+
+// missingAsset explains that rel has no asset to build. When it has other
+// games' zips they are listed, which points out a mistyped -game.
+func missingAsset(rel release.Release) string {
+	if games := releaseGames(rel); len(games) > 0 && game != defaultGame {
+		return fmt.Sprintf("%s has no %s to download (it has: %s)", rel.TagName, cfg.AssetName, strings.Join(games, ", "))
+	}
+	return fmt.Sprintf("%s has no %s to download (it predates it)", rel.TagName, cfg.AssetName)
+}
+
+// newSourceStamp describes building rel's configured asset with filters. It
+// returns false if the release lists no such asset.
+func newSourceStamp(rel release.Release, filters repack.FilterSet) (stamp.Stamp, bool) {
+	for _, a := range rel.Assets {
+		if a.Name == cfg.AssetName {
+			return stamp.Stamp{
+				Tag:       rel.TagName,
+				Asset:     a.Name,
+				Size:      a.Size,
+				Digest:    a.Digest,
+				UpdatedAt: a.UpdatedAt,
+				Filters:   filters.String(),
+
+				Prefix:     archivePrefix,
+				NoMetadata: os.Getenv("NO_METADATA") == "1",
+			}, true
+		}
+	}
+	return stamp.Stamp{}, false
+}
+
+// sourceUnchanged reports whether archive's .source.json says it was built
+// from the same asset (by digest, size and upload time) with the same filters
+// and output options.
+func sourceUnchanged(archive string, rel release.Release, filters repack.FilterSet) bool {
+	want, ok := newSourceStamp(rel, filters)
+	if !ok {
+		return false
+	}
+	return stamp.Unchanged(archive, want)
+}
+
+// writeSourceStamp saves archive's .source.json. Failures are only logged:
+// without a stamp the next run simply rebuilds.
+func writeSourceStamp(archive string, rel release.Release, filters repack.FilterSet) {
+	s, ok := newSourceStamp(rel, filters)
+	if !ok {
+		return
+	}
+	if err := stamp.Write(archive, s); err != nil {
+		logf(levelDebug, "writing source stamp: %v", err)
+	}
+}
+
+// writeChecksum computes the SHA256 of path and writes a sibling
+// <path>.sha256 in sha256sum format. It returns the hex digest.
+func writeChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	line := fmt.Sprintf("%s  %s\n", digest, filepath.Base(path))
+	if err := os.WriteFile(path+".sha256", []byte(line), 0644); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Config holds user preferences from config.json. Settings given through
+// env vars or flags override these values for a single run.
+type Config struct {
+	MaxList   int      `json:"MaxList,omitempty"`
+	OutputDir string   `json:"OutputDir,omitempty"`
+	Filters   []string `json:"Filters,omitempty"`
+	Repo      string   `json:"Repo,omitempty"`
+	AssetName string   `json:"AssetName,omitempty"`
+
+	// Mirrors are download base URLs tried in order before GitHub
+	Mirrors []string `json:"Mirrors,omitempty"`
+
+	// Profiles are extra named exclude lists, picked with -profile
+	Profiles map[string][]string `json:"Profiles,omitempty"`
+
+	// UpdateRepo is where the startup update check looks for new builders
+	UpdateRepo string `json:"UpdateRepo,omitempty"`
+}
+
+// legacyCacheDir is where releases and downloads were cached before the
+// cache moved to the user cache directory.
+const legacyCacheDir = ".cache_github"
+
+// The GitHub cache: the release list, its ETag and downloaded assets. Set by
+// initCache.
+var (
+	cacheDir    string
+	githubCache cache.Files
+)
+
+// initCache points the GitHub cache at CACHE_DIR, or at
+// reframework-builder/github under the user cache directory (which follows
+// XDG_CACHE_HOME on Linux). A .cache_github left in the working directory by
+// older versions is moved there while the new folder doesn't exist yet.
+func initCache() (moved bool, err error) {
+	cacheDir = os.Getenv("CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = legacyCacheDir
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "reframework-builder", "github")
+		}
+	}
+	githubCache = cache.In(cacheDir)
+
+	if fi, err := os.Stat(legacyCacheDir); err != nil || !fi.IsDir() {
+		return false, nil
+	}
+	if _, err := os.Stat(cacheDir); err == nil {
+		return false, nil // already migrated, or CACHE_DIR is the old folder
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(legacyCacheDir, cacheDir); err == nil {
+		return true, nil
+	}
+	// Rename fails across volumes: copy the files, then drop the old folder
+	entries, err := os.ReadDir(legacyCacheDir)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(legacyCacheDir, e.Name()), filepath.Join(cacheDir, e.Name()), nil); err != nil {
+			return false, err
+		}
+	}
+	return true, os.RemoveAll(legacyCacheDir)
+}
+
+// configPath returns ~/.config/reframework-builder/config.json (or the
+// platform equivalent).
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "reframework-builder", "config.json"), nil
+}
+
+// loadConfig reads config.json and fills unset fields with the built-in
+// defaults. A missing config file is not an error.
+func loadConfig() (Config, error) {
+	var c Config
+	if path, err := configPath(); err == nil {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if err := json.Unmarshal(data, &c); err != nil {
+				return c, fmt.Errorf("parse %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return c, err
+		}
+	}
+
+	if c.MaxList <= 0 {
+		c.MaxList = 20
+	}
+	if c.OutputDir == "" {
+		c.OutputDir = "."
+	}
+	if c.Filters == nil {
+		c.Filters = []string{"RE", "vr", "xr", "VR", "XR", "DELETE", "OpenVR", "OpenXR"}
+	}
+	if c.Repo == "" {
+		c.Repo = defaultRepo
+	}
+	if c.AssetName == "" {
+		c.AssetName = zipName
+	}
+	if c.UpdateRepo == "" {
+		c.UpdateRepo = builderRepo
+	}
+	return c, nil
+}
+
+// filterProfiles returns the named exclude lists: the built-in "novr" (the
+// Filters list) and "full" (nothing removed), plus any Profiles from
+// config.json, which may also override the built-in ones.
+func filterProfiles(c Config) map[string][]string {
+	profiles := map[string][]string{defaultProfile: c.Filters, "full": {}}
+	for name, patterns := range c.Profiles {
+		profiles[name] = patterns
+	}
+	return profiles
+}
+
+// profileNames returns the profile names in c, sorted.
+func profileNames(c Config) []string {
+	var names []string
+	for name := range filterProfiles(c) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileFilters returns the exclude list of the named profile.
+func profileFilters(c Config, name string) ([]string, error) {
+	if patterns, ok := filterProfiles(c)[name]; ok {
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("unknown filter profile %q (available: %s)", name, strings.Join(profileNames(c), ", "))
+}
+
+// saveConfig writes c to config.json, creating its directory if needed.
+func saveConfig(c Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// envOr returns the value of the environment variable key, or def if unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Log levels for logf. The log area shows warnings, errors and progress
+// notes; debug lines only appear with VERBOSE=1.
+const (
+	levelError = iota
+	levelInfo
+	levelDebug
+)
+
+// verbosity is the highest level logf prints; VERBOSE=1 raises it to
+// levelDebug.
+var verbosity = levelInfo
+
+// logf adds a line to the log area if level is enabled. Debug lines are tagged
+// and always go to the log file, even when hidden.
+func logf(level int, format string, args ...interface{}) {
+	if level == levelDebug {
+		format = "[debug] " + format
+	}
+	if level > verbosity {
+		writeLogFile(fmt.Sprintf(format, args...))
+		return
+	}
+	showLog(fmt.Sprintf(format, args...))
+}
+
+// keepLogs is how many build-*.log files openBuildLog leaves behind.
+const keepLogs = 5
+
+// The log file of the current build, mirroring the log area and status line.
+var (
+	logMu   sync.Mutex
+	logFile *os.File
+)
+
+// logDir is the folder holding the build logs.
+func logDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "reframework-builder", "logs"), nil
+}
+
+// openBuildLog starts logs/build-<timestamp>.log and deletes all but the
+// newest keepLogs logs.
+func openBuildLog() error {
+	dir, err := logDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, "build-"+time.Now().Format("20060102-150405")+".log"))
+	if err != nil {
+		return err
+	}
+	logMu.Lock()
+	logFile = f
+	logMu.Unlock()
+
+	// Timestamped names sort oldest first
+	old, _ := filepath.Glob(filepath.Join(dir, "build-*.log"))
+	sort.Strings(old)
+	for len(old) > keepLogs {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+	return nil
+}
+
+// writeLogFile appends a timestamped line to the build log, if one is open.
+func writeLogFile(msg string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logFile != nil {
+		fmt.Fprintf(logFile, "%s %s\n", time.Now().Format("15:04:05"), msg)
+	}
+}
+
+// openLogFolder shows the log folder in the file manager.
+func openLogFolder() {
+	dir, err := logDir()
+	if err != nil {
+		dialog.ShowError(err, fyneWin)
+		return
+	}
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	if err := fyneApp.OpenURL(u); err != nil {
+		dialog.ShowError(err, fyneWin)
+	}
+}
+
+// rateLimit caps download speed in bytes per second (-limit); 0 means
+// unlimited.
+var rateLimit int
+
+// limiter is shared by every throttled reader, so ranges downloaded in
+// parallel stay under rateLimit together.
+var (
+	limiter     *rate.Limiter
+	limiterOnce sync.Once
+)
+
+// throttle wraps r so reads don't exceed rateLimit. Progress readers wrap
+// the result, so their percentage and ETA follow the throttled rate.
+func throttle(r io.Reader) io.Reader {
+	if rateLimit <= 0 {
+		return r
+	}
+	// A one-second burst keeps the token bucket close to the cap
+	limiterOnce.Do(func() { limiter = rate.NewLimiter(rate.Limit(rateLimit), rateLimit) })
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rl.limiter.Burst() {
+		p = p[:rl.limiter.Burst()]
+	}
+	n, err := rl.r.Read(p)
+	if n > 0 {
+		if werr := rl.limiter.WaitN(downloadCtx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// downloadCtx is cancelled on interrupt so in-flight downloads and
+// transcodes stop.
+var downloadCtx, cancelDownloads = context.WithCancel(context.Background())
+
+// transcoding counts transcodes in flight, so an interrupt can let them
+// close their output before the cleanup deletes it.
+var transcoding atomic.Int32
+
+// Paths to delete if the build is interrupted: the temp workspace and any
+// partially written files.
+var (
+	cleanupMu    sync.Mutex
+	cleanupPaths []string
+)
+
+// removeOnInterrupt registers path for deletion if the build is interrupted.
+func removeOnInterrupt(path string) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanupPaths = append(cleanupPaths, path)
+}
+
+// keepOnInterrupt undoes removeOnInterrupt once path is complete.
+func keepOnInterrupt(path string) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for i, p := range cleanupPaths {
+		if p == path {
+			cleanupPaths = append(cleanupPaths[:i], cleanupPaths[i+1:]...)
+			break
+		}
+	}
+}
+
+// cleanupInterrupted cancels downloads and transcodes and deletes every
+// registered path.
+func cleanupInterrupted() {
+	cancelDownloads()
+	// A cancelled transcode stops at its next entry; give it a moment to
+	// close its .partial file, which Windows won't delete while it's open
+	for deadline := time.Now().Add(2 * time.Second); transcoding.Load() > 0 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+	}
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for _, p := range cleanupPaths {
+		os.RemoveAll(p)
+	}
+	cleanupPaths = nil
+}
+
+// The release-list request is tried up to releaseAttempts times, waiting
+// releaseRetryDelay after the first failure and twice as long after each
+// one that follows.
+const (
+	releaseAttempts   = 3
+	releaseRetryDelay = time.Second
+)
+
+// requestReleases asks the GitHub API for the release list, conditionally
+// when etag is set. Network errors and 5xx responses are retried with
+// backoff; anything else, a rate limit included, is returned at once.
+// Retries are reported to rep.
+func requestReleases(rep report.Reporter, etag string) (*http.Response, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	delay := releaseRetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := requestReleasesOnce(client, etag)
+		transient := (err != nil && downloadCtx.Err() == nil) || (err == nil && resp.StatusCode >= 500)
+		if !transient || attempt == releaseAttempts {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = errors.New(resp.Status)
+		}
+		rep.Log(fmt.Sprintf("Fetching the release list failed (%v), retrying in %s...", err, delay))
+		select {
+		case <-downloadCtx.Done():
+			return nil, downloadCtx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// requestReleasesOnce makes a single release-list request for
+// requestReleases.
+func requestReleasesOnce(client *http.Client, tag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "GET", "https://api.github.com/repos/"+cfg.Repo+"/releases?per_page=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	if tag := etag.Normalize(tag); tag != "" {
+		req.Header.Set("If-None-Match", tag)
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	logf(levelDebug, "GET %s: %s", req.URL, resp.Status)
+	return resp, nil
+}
+
+// saveReleases caches a freshly fetched release list and the ETag it came
+// with. Nothing is written while the cache is read-only.
+func saveReleases(data []byte, etag string) {
+	if cacheReadOnly {
+		logf(levelDebug, "cache is locked by another instance, not saving the release list")
+		return
+	}
+	if err := githubCache.SaveReleases(data, etag); err != nil {
+		logf(levelDebug, "saving the release list: %v", err)
+	}
+}
+
+// cacheReadOnly is set while another instance holds the cache lock: the
+// cache is still read, but this run doesn't update it.
+var cacheReadOnly bool
+
+// staleLockAge is when a cache lock counts as left behind by a run that
+// died holding it. The lock is only held around a release list fetch,
+// which times out well before this.
+const staleLockAge = 2 * time.Minute
+
+// lockCache takes cacheDir/.lock, created with O_EXCL, for the release
+// list fetch so two instances can't interleave their updates of the list
+// and its ETag. If another instance holds it, cacheReadOnly is set and the
+// run carries on with the existing cache. The returned func releases the
+// lock and clears cacheReadOnly.
+func lockCache() (unlock func()) {
+	path, err := githubCache.Lock(staleLockAge)
+	if err == nil {
+		removeOnInterrupt(path)
+		return func() {
+			os.Remove(path)
+			keepOnInterrupt(path)
+		}
+	}
+	if !errors.Is(err, cache.ErrLocked) {
+		logf(levelDebug, "cache lock: %v", err) // the writes will likely fail too, but only cost a refetch
+		return func() {}
+	}
+	logf(levelDebug, "cache locked by another instance, using it read-only")
+	cacheReadOnly = true
+	return func() { cacheReadOnly = false }
+}
+
+// httpGet is http.Get bound to downloadCtx, through downloadClient.
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return downloadClient.Do(req)
+}
+
+// downloadClient fetches release assets. It logs each redirect hop, so a
+// failed download shows where GitHub sent it on to its CDN.
+var downloadClient = &http.Client{CheckRedirect: logRedirect}
+
+// logRedirect is downloadClient's CheckRedirect: it logs the hop at debug
+// level and keeps net/http's default limit of 10 redirects.
+func logRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	prev, status := via[len(via)-1], "redirect"
+	if req.Response != nil {
+		status = req.Response.Status
+	}
+	logf(levelDebug, "%s %s: %s, to %s", prev.Method, prev.URL, status, req.URL)
+	return nil
+}
+
+// statusError describes a download that got HTTP status instead of the
+// asset. A 404 names the requested URL and, if a redirect led elsewhere,
+// the final one, which tells a wrong asset name from a bad redirect.
+func statusError(resp *http.Response, url string) error {
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if final := resp.Request.URL.String(); final != url {
+		return fmt.Errorf("HTTP %s for %s (redirected to %s)", resp.Status, url, final)
+	}
+	return fmt.Errorf("HTTP %s for %s", resp.Status, url)
+}
+
+// Set at link time by build.sh (-X main.builderVersion=... etc.).
+var (
+	builderVersion   = "dev"
+	builderCommit    = ""
+	builderBuildTime = ""
+)
+
+// versionString reports the builder's version, commit and Go version.
+// Values stamped by build.sh win; otherwise the embedded build info fills in
+// what it can.
+func versionString() string {
+	version, commit := builderVersion, builderCommit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && commit == "" {
+				commit = s.Value
+			}
+		}
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	details := "commit " + commit
+	if builderBuildTime != "" {
+		details += ", built " + builderBuildTime
+	}
+	return fmt.Sprintf("REFramework Builder %s (%s, %s)", version, details, runtime.Version())
+}
+
+// metaFile is the build-info entry added to every output archive, under
+// the prefix folder.
+const metaFile = "_reframework_builder.json"
+
+// metaName is metaFile with the prefix folder.
+func metaName() string {
+	return prefixed(metaFile)
+}
+
+// buildMeta is the content of metaName: where the archive came from and
+// what the builder removed.
+type buildMeta struct {
+	Builder        string     `json:"builder"`
+	BuilderVersion string     `json:"builderVersion"`
+	BuilderBuilt   string     `json:"builderBuildTime,omitempty"`
+	SourceTag      string     `json:"sourceTag,omitempty"`
+	SourceFile     string     `json:"sourceFile,omitempty"`
+	PublishedAt    *time.Time `json:"publishedAt,omitempty"`
+	FilterMode     string     `json:"filterMode"`
+	Patterns       []string   `json:"patterns"`
+	OnlyDirs       []string   `json:"onlyDirs,omitempty"`
+	RemovedFiles   int        `json:"removedFiles"`
+}
+
+// newBuildMeta describes a build of tag (or, for -input, the local file
+// src, whose publish date is unknown). It returns nil when NO_METADATA=1.
+func newBuildMeta(tag, src string, published time.Time, filters repack.FilterSet) *buildMeta {
+	if os.Getenv("NO_METADATA") == "1" {
+		return nil
+	}
+	m := &buildMeta{
+		Builder:        "REFrameworkBuilder-MHWilds-noVR",
+		BuilderVersion: builderVersion,
+		BuilderBuilt:   builderBuildTime,
+		SourceTag:      tag,
+		FilterMode:     "exclude",
+		Patterns:       filters.Patterns,
+		OnlyDirs:       filters.OnlyDirs,
+	}
+	if tag == "" {
+		m.SourceFile = filepath.Base(src)
+	} else {
+		t := published.UTC()
+		m.PublishedAt = &t
+	}
+	if filters.KeepOnly {
+		m.FilterMode = "keep"
+	}
+	return m
+}
+
+// metaJSON returns the metadata entry's content with the removed count set.
+func metaJSON(m *buildMeta, stats repack.Stats) ([]byte, error) {
+	m.RemovedFiles = stats.Removed
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// forbiddenReason explains a 403 or 429 from the GitHub API. A rate limit
+// (no requests remaining, or a Retry-After) reports when it resets; anything
+// else is an access failure, usually a bad GITHUB_TOKEN.
+func forbiddenReason(resp *http.Response) string {
+	h := resp.Header
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		h.Get("X-RateLimit-Remaining") == "0" || h.Get("Retry-After") != ""
+	if !limited {
+		if os.Getenv("GITHUB_TOKEN") != "" {
+			return fmt.Sprintf("GitHub API denied access (%d); check that GITHUB_TOKEN is valid", resp.StatusCode)
+		}
+		return fmt.Sprintf("GitHub API denied access (%d)", resp.StatusCode)
+	}
+
+	msg := "GitHub API rate limit exceeded"
+	if wait, ok := rateLimitReset(h, time.Now()); ok {
+		msg += fmt.Sprintf("; it resets in %s", wait.Round(time.Second))
+	}
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		msg += ". Set GITHUB_TOKEN to a GitHub token for a higher limit"
+	}
+	return msg
+}
+
+// rateLimitReset returns how long until the API rate limit resets, from
+// Retry-After (seconds) or X-RateLimit-Reset (Unix time).
+func rateLimitReset(h http.Header, now time.Time) (time.Duration, bool) {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if s, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return max(time.Unix(s, 0).Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// updateCheck is the cached result of the last update check.
+type updateCheck struct {
+	Repo      string    `json:"repo"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest"`
+	URL       string    `json:"url"`
+}
+
+// checkForUpdate returns the latest release of the builder itself if it is
+// newer than this build. The answer is cached for a day. Dev builds,
+// NO_UPDATE_CHECK=1 and failed checks report nothing.
+func checkForUpdate() (tag, url string, ok bool) {
+	if os.Getenv("NO_UPDATE_CHECK") == "1" || !strings.HasPrefix(builderVersion, "v") {
+		return "", "", false
+	}
+	var c updateCheck
+	path := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "reframework-builder", "update-check.json")
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &c)
+		}
+	}
+	if c.Repo != cfg.UpdateRepo || time.Since(c.CheckedAt) > 24*time.Hour {
+		latest, u, err := latestBuilderRelease(cfg.UpdateRepo)
+		if err != nil {
+			logf(levelDebug, "update check: %v", err)
+			return "", "", false
+		}
+		c = updateCheck{Repo: cfg.UpdateRepo, CheckedAt: time.Now(), Latest: latest, URL: u}
+		if path != "" && os.MkdirAll(filepath.Dir(path), 0755) == nil {
+			if data, err := json.Marshal(c); err == nil {
+				cache.WriteFileAtomic(path, data)
+			}
+		}
+	}
+	return c.Latest, c.URL, newerVersion(c.Latest, builderVersion)
+}
+
+// latestBuilderRelease returns the tag and page URL of repo's latest release.
+func latestBuilderRelease(repo string) (string, string, error) {
+	u := "https://api.github.com/repos/" + repo + "/releases/latest"
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	logf(levelDebug, "GET %s: %s", u, resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("API returned %s", resp.Status)
+	}
+	var rel struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return "", "", err
+	}
+	return rel.TagName, rel.HTMLURL, nil
+}
+
+// newerVersion reports whether tag a is a later vX.Y.Z than b. Anything
+// after a "-" (such as a git describe suffix) is ignored.
+func newerVersion(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// versionParts returns the leading numeric components of a vX.Y.Z tag.
+func versionParts(v string) []int {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// releasePageURL is the GitHub page of a release tag.
+func releasePageURL(tag string) string {
+	return fmt.Sprintf("https://github.com/%s/releases/tag/%s", cfg.Repo, tag)
+}
+
+// assetURL is the download URL of the configured asset for a release tag.
+func assetURL(tag string) string {
+	return fmt.Sprintf("https://github.com/%s/releases/download/%s/%s", cfg.Repo, tag, cfg.AssetName)
+}
+
+// assetURLs lists the sources to download the asset for tag from, in the
+// order to try them: each mirror (<base>/<tag>/<asset>), then GitHub.
+func assetURLs(tag string) []string {
+	var urls []string
+	for _, m := range cfg.Mirrors {
+		urls = append(urls, strings.TrimRight(m, "/")+"/"+tag+"/"+cfg.AssetName)
+	}
+	return append(urls, assetURL(tag))
+}
+
+// downloadChunks is how many byte ranges a download is split into and
+// fetched in parallel (DOWNLOAD_CHUNKS); 1 downloads in a single stream.
+var downloadChunks = 1
+
+// minChunkSize keeps small files from being split into tiny ranges.
+const minChunkSize = 1 << 20
+
+// downloadAsset downloads the configured asset for tag to dst, trying each
+// source from assetURLs in turn until one succeeds. Progress and the
+// switches to another source go to rep.
+func downloadAsset(tag, dst string, rep report.Reporter) error {
+	var err error
+	for i, url := range assetURLs(tag) {
+		if i > 0 {
+			rep.Log(fmt.Sprintf("Warning: download failed (%v); trying %s", err, url))
+			rep.Progress(0)
+		}
+		if err = downloadURL(url, dst, rep); err == nil || downloadCtx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// downloadURL downloads url to dst, in parallel byte ranges when
+// downloadChunks asks for it and the server supports them, otherwise in a
+// single stream, reporting its progress to rep.
+func downloadURL(url, dst string, rep report.Reporter) error {
+	if downloadChunks > 1 {
+		size, ranges, err := probeRanges(url)
+		switch {
+		case err != nil:
+			logf(levelDebug, "HEAD %s: %v", url, err)
+		case ranges && size >= int64(downloadChunks)*minChunkSize:
+			return downloadRanges(url, dst, size, rep)
+		default:
+			logf(levelDebug, "%s: no byte ranges (or too small to split), downloading in one stream", url)
+		}
+	}
+
+	resp, err := httpGet(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	logf(levelDebug, "GET %s: %s", url, resp.Status)
+	if final := resp.Request.URL.String(); final != url {
+		logf(levelDebug, "final URL: %s", final)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, url)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	pr := &ProgressReader{Reader: throttle(resp.Body), Total: resp.ContentLength, Rep: rep}
+	_, err = io.Copy(out, pr)
+	if closeErr := out.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = pr.Verify()
+	}
+	return err
+}
+
+// probeRanges asks for url's size and whether it can be fetched in byte
+// ranges (Accept-Ranges: bytes).
+func probeRanges(url string) (size int64, ranges bool, err error) {
+	req, err := http.NewRequestWithContext(downloadCtx, "HEAD", url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return resp.ContentLength, resp.ContentLength > 0 && resp.Header.Get("Accept-Ranges") == "bytes", nil
+}
+
+// downloadRanges fetches url into dst as downloadChunks parallel byte
+// ranges, each written at its own offset. One shared ProgressReader counts
+// the bytes of all of them.
+func downloadRanges(url, dst string, size int64, rep report.Reporter) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+	logf(levelDebug, "GET %s in %d ranges", url, downloadChunks)
+
+	ctx, cancel := context.WithCancel(downloadCtx)
+	defer cancel()
+	pr := &ProgressReader{Total: size, Rep: rep}
+	chunk := (size + int64(downloadChunks) - 1) / int64(downloadChunks)
+	errs := make(chan error, downloadChunks)
+	parts := 0
+	for start := int64(0); start < size; start += chunk {
+		end := min(start+chunk, size) - 1
+		parts++
+		go func() { errs <- fetchRange(ctx, url, out, start, end, pr) }()
+	}
+	for range parts {
+		if err2 := <-errs; err2 != nil && err == nil {
+			err = err2
+			cancel() // stop the other ranges
+		}
+	}
+	if err == nil {
+		err = pr.Verify()
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// fetchRange downloads bytes start..end (inclusive) of url into out at
+// offset start.
+func fetchRange(ctx context.Context, url string, out *os.File, start, end int64, pr *ProgressReader) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range %d-%d: HTTP %s", start, end, resp.Status)
+	}
+	n, err := io.Copy(io.NewOffsetWriter(out, start), pr.Part(throttle(resp.Body)))
+	if err == nil && n != end-start+1 {
+		err = fmt.Errorf("range %d-%d: got %d bytes", start, end, n)
+	}
+	return err
+}
+
+// editSettings walks through the saved preferences with entry dialogs and
+// writes them to config.json. Changes apply to the next build.
+func editSettings() {
+	c, err := loadConfig()
+	if err != nil {
+		showError(fmt.Sprintf("Error reading config:\n%v", err))
+		return
+	}
+
+	val, ok := askEntry("Settings", "Releases to show", strconv.Itoa(c.MaxList))
+	if !ok {
+		return
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && n > 0 {
+		c.MaxList = n
+	}
+	if c.OutputDir, ok = askEntry("Settings", "Output directory", c.OutputDir); !ok {
+		return
+	}
+	if val, ok = askEntry("Settings", "Exclude patterns (comma-separated)", strings.Join(c.Filters, ",")); !ok {
+		return
+	}
+	c.Filters = splitPatterns(val)
+	if _, err := repack.NewFilterSet(c.Filters, false); err != nil {
+		showError(fmt.Sprintf("Settings not saved:\n%v", err))
+		return
+	}
+	if c.Repo, ok = askEntry("Settings", "Release repo (owner/name)", c.Repo); !ok {
+		return
+	}
+	if c.AssetName, ok = askEntry("Settings", "Asset name", c.AssetName); !ok {
+		return
+	}
+
+	path, _ := configPath()
+	if !askConfirm("Save Settings", fmt.Sprintf("Save settings to %s?\nThey apply to the next build.", path)) {
+		return
+	}
+	if err := saveConfig(c); err != nil {
+		showError(fmt.Sprintf("Error saving settings:\n%v", err))
+		return
+	}
+	logf(levelInfo, "Settings saved to %s.", path)
+}
+
+// sizeSaver is a single-child layout that fills the window and records its
+// size in the app preferences, so the next launch opens at the same size.
+type sizeSaver struct {
+	prefs fyne.Preferences
+}
+
+func (s *sizeSaver) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	for _, o := range objects {
+		o.Move(fyne.NewPos(0, 0))
+		o.Resize(size)
+	}
+	if size.Width > 0 && size.Height > 0 {
+		s.prefs.SetFloat(prefWinWidth, float64(size.Width))
+		s.prefs.SetFloat(prefWinHeight, float64(size.Height))
+	}
+}
+
+func (s *sizeSaver) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	min := fyne.NewSize(0, 0)
+	for _, o := range objects {
+		min = min.Max(o.MinSize())
+	}
+	return min
+}
+
+// checkWritable makes sure a file can be created in dir, creating dir if
+// needed, so a read-only folder stops the run before the download rather
+// than at the end of it.
+func checkWritable(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".write-test-*"); err == nil {
+			f.Close()
+			return os.Remove(f.Name())
+		}
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err // the folder is named below
+	}
+	if abs, aerr := filepath.Abs(dir); aerr == nil {
+		dir = abs
+	}
+	return fmt.Errorf("can't write to %s: %w", dir, err)
+}
+
+// copyFile copies src to dst. A non-nil pr reports the progress: its Reader
+// and Total are set to the source file.
+func copyFile(src, dst string, pr *ProgressReader) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if pr != nil {
+		fi, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		pr.Reader, pr.Total = in, fi.Size()
+		r = pr
+	}
+
+	out, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, in)
+	w := bufio.NewWriterSize(out, ioBufSize)
+	_, err = io.Copy(w, bufio.NewReaderSize(r, ioBufSize))
 	if err != nil {
 		return err
 	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
 
 	return out.Close()
 }
@@ -0,0 +1,141 @@
+// Package cache keeps the GitHub release list, and the ETag it came with,
+// in a folder shared by every run of the builders.
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"buildREFramework/etag"
+	"buildREFramework/release"
+)
+
+// Files are the paths of a cache folder's files.
+type Files struct {
+	Dir      string
+	Releases string // the release list as the API sent it
+	ETag     string // the ETag of that list, for conditional requests
+}
+
+// In returns the files of the cache folder dir.
+func In(dir string) Files {
+	return Files{Dir: dir, Releases: filepath.Join(dir, "releases.json"), ETag: filepath.Join(dir, "etag")}
+}
+
+// ReadETag returns the cached release list's ETag, or "" if there is none
+// or it is malformed.
+func (c Files) ReadETag() string {
+	data, err := os.ReadFile(c.ETag)
+	if err != nil {
+		return ""
+	}
+	return etag.Normalize(string(data))
+}
+
+// WriteETag saves tag, normalized, for the next conditional request. A
+// malformed one removes the saved ETag instead.
+func (c Files) WriteETag(tag string) error {
+	if tag = etag.Normalize(tag); tag == "" {
+		os.Remove(c.ETag)
+		return nil
+	}
+	return WriteFileAtomic(c.ETag, []byte(tag))
+}
+
+// SaveReleases caches a freshly fetched release list and the ETag it came
+// with (kept as is when the response had none). The list is written first,
+// so a crash in between leaves an ETag that only matches older data and the
+// next run refetches.
+func (c Files) SaveReleases(data []byte, tag string) error {
+	if err := WriteFileAtomic(c.Releases, data); err != nil {
+		return err
+	}
+	if tag != "" {
+		return c.WriteETag(tag)
+	}
+	return nil
+}
+
+// ReadReleases loads the cached release list. A missing, empty or
+// unparsable file is an error rather than an empty list.
+func (c Files) ReadReleases() ([]release.Release, error) {
+	data, err := os.ReadFile(c.Releases)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%s is empty", c.Releases)
+	}
+	var releases []release.Release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", c.Releases, err)
+	}
+	return releases, nil
+}
+
+// FetchTime is when the cached release list was last fetched or found
+// current, for the messages that fall back to it.
+func (c Files) FetchTime() string {
+	fi, err := os.Stat(c.Releases)
+	if err != nil {
+		return "an unknown time"
+	}
+	return fi.ModTime().Format("2006-01-02 15:04")
+}
+
+// ErrLocked is returned by Lock while another instance holds the lock.
+var ErrLocked = errors.New("cache is locked by another instance")
+
+// Lock takes the folder's .lock, created with O_EXCL and holding this
+// process's pid, so two instances can't interleave their updates of the
+// release list and its ETag. A lock older than staleAge counts as left
+// behind by a run that died holding it and is taken over. It returns the
+// lock's path, or ErrLocked if another instance holds it.
+func (c Files) Lock(staleAge time.Duration) (string, error) {
+	path := filepath.Join(c.Dir, ".lock")
+	for retried := false; ; retried = true {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		if fi, err := os.Stat(path); retried || err != nil || time.Since(fi.ModTime()) < staleAge {
+			return "", ErrLocked
+		}
+		os.Remove(path)
+	}
+}
+
+// WriteFileAtomic replaces path with data through a temp file in the same
+// dir and a rename, so a reader in another instance sees the old content or
+// the new, never half of it.
+func WriteFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
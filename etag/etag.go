@@ -0,0 +1,24 @@
+// Package etag cleans up the entity tags the builders save with their
+// cached release list and send back in If-None-Match.
+package etag
+
+import (
+	"regexp"
+	"strings"
+)
+
+// etagRe matches a strong or weak entity tag: "xyz" or W/"xyz".
+var etagRe = regexp.MustCompile(`^(W/)?"[^"\x00-\x20\x7f]*"$`)
+
+// Normalize strips the whitespace, line endings and byte order mark an
+// editor or another OS may leave around etag, keeping its quotes and any W/
+// prefix. It returns "" unless what is left is a well-formed entity tag, so
+// a damaged value means an unconditional request rather than one that can
+// never match.
+func Normalize(etag string) string {
+	etag = strings.Trim(etag, " \t\r\n\ufeff")
+	if !etagRe.MatchString(etag) {
+		return ""
+	}
+	return etag
+}
@@ -0,0 +1,45 @@
+package etag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`"abc123"`, `"abc123"`},
+		{`W/"abc123"`, `W/"abc123"`},
+		{"W/\"abc123\"\r\n", `W/"abc123"`},
+		{"\ufeff \"abc123\"\t", `"abc123"`},
+		{`""`, `""`},
+		{"", ""},
+		{`abc123`, ""},
+		{`w/"abc123"`, ""},
+		{`W/abc123`, ""},
+		{`"abc"123"`, ""},
+		{`"abc 123"`, ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWeakRoundTrip(t *testing.T) {
+	// As saved by an editor on Windows, then read back for If-None-Match
+	path := filepath.Join(t.TempDir(), "etag")
+	if err := os.WriteFile(path, []byte(Normalize(`W/"abc"`)+"\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Normalize(string(data)); got != `W/"abc"` {
+		t.Errorf("round trip = %q, want %q", got, `W/"abc"`)
+	}
+}
@@ -2,7 +2,11 @@ module buildREFramework
 
 go 1.24.12
 
-require fyne.io/fyne/v2 v2.7.3
+require (
+	fyne.io/fyne/v2 v2.7.3
+	golang.org/x/sys v0.30.0
+	golang.org/x/time v0.14.0
+)
 
 require (
 	fyne.io/systray v1.12.0 // indirect
@@ -34,7 +38,6 @@ require (
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
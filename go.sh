@@ -10,7 +10,7 @@ for arg in "$@"; do
 done
 
 # Run the build tool
-./buildREFramework
+./buildREFramework "$@"
 EXIT_CODE=$?
 
 if [ $EXIT_CODE -eq 2 ]; then
@@ -0,0 +1,128 @@
+// Package install finds the Monster Hunter Wilds install and extracts a
+// built archive into it.
+package install
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"buildREFramework/repack"
+)
+
+// GameExe is the file that marks a game folder.
+const GameExe = "MonsterHunterWilds.exe"
+
+// FindGameDir looks for the Monster Hunter Wilds install in the Steam
+// locations of this platform (see steamRoots) and every library listed in
+// their libraryfolders.vdf.
+func FindGameDir() (string, error) {
+	roots := steamRoots()
+	pathRe := regexp.MustCompile(`"path"\s+"([^"]+)"`)
+	libs := append([]string(nil), roots...)
+	for _, root := range roots {
+		data, err := os.ReadFile(filepath.Join(root, "steamapps", "libraryfolders.vdf"))
+		if err != nil {
+			continue
+		}
+		for _, m := range pathRe.FindAllStringSubmatch(string(data), -1) {
+			libs = append(libs, strings.ReplaceAll(m[1], `\\`, `\`))
+		}
+	}
+
+	for _, lib := range libs {
+		dir := filepath.Join(lib, "steamapps", "common", "MonsterHunterWilds")
+		if IsGameDir(dir) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("could not find %s; set the game folder with -game-dir or GAME_DIR", GameExe)
+}
+
+// IsGameDir reports whether dir contains GameExe.
+func IsGameDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, GameExe))
+	return err == nil
+}
+
+// Archive extracts the built zip archive into gameDir, dropping prefix (the
+// archive's root folder, with its slash) and skipping the metadata entry
+// metaName and symlinks. Files it would overwrite are first moved to a
+// timestamped backup folder inside gameDir. It returns the files written
+// and backed up (relative to gameDir) and the backup folder, if one was
+// needed.
+func Archive(archive, gameDir, prefix, metaName string) (written, backedUp []string, backupDir string, err error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer r.Close()
+	repack.NormalizeNames(r.File)
+
+	root, err := filepath.Abs(gameDir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	stamp := filepath.Join(root, "reframework_backup_"+time.Now().Format("20060102-150405"))
+
+	for _, f := range r.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if name == "" || f.Name == metaName || f.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		// Refuse entries that would land outside the game folder
+		rel := filepath.Clean(filepath.FromSlash(name))
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return written, backedUp, backupDir, fmt.Errorf("unsafe path in archive: %s", f.Name)
+		}
+		dest := filepath.Join(root, rel)
+		// Create folders the archive has as entries, empty ones included
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return written, backedUp, backupDir, err
+			}
+			continue
+		}
+
+		if fi, err := os.Lstat(dest); err == nil && !fi.IsDir() {
+			bak := filepath.Join(stamp, rel)
+			if err := os.MkdirAll(filepath.Dir(bak), 0755); err != nil {
+				return written, backedUp, backupDir, err
+			}
+			if err := os.Rename(dest, bak); err != nil {
+				return written, backedUp, backupDir, err
+			}
+			backupDir = stamp
+			backedUp = append(backedUp, rel)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return written, backedUp, backupDir, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return written, backedUp, backupDir, err
+		}
+		out, err := os.Create(dest)
+		if err != nil {
+			rc.Close()
+			return written, backedUp, backupDir, err
+		}
+		_, err = io.Copy(out, rc)
+		rc.Close()
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return written, backedUp, backupDir, err
+		}
+		written = append(written, rel)
+	}
+	return written, backedUp, backupDir, nil
+}
@@ -0,0 +1,73 @@
+package install
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes a built archive holding the given entries to a temp file.
+// An entry whose name is a key of links is a symlink to that target.
+func writeZip(t *testing.T, entries []string, links map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "built.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, name := range entries {
+		hdr := &zip.FileHeader{Name: name}
+		body := "contents of " + name
+		if target, ok := links[name]; ok {
+			hdr.SetMode(os.ModeSymlink | 0777)
+			body = target
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestArchiveSkipsSymlinks(t *testing.T) {
+	archive := writeZip(t, []string{"MHWILDS/dinput8.dll", "MHWILDS/passwd.dll"}, map[string]string{"MHWILDS/passwd.dll": "/etc/passwd"})
+	gameDir := t.TempDir()
+	written, _, _, err := Archive(archive, gameDir, "MHWILDS/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0] != "dinput8.dll" {
+		t.Errorf("written = %q, want only dinput8.dll", written)
+	}
+	if _, err := os.Lstat(filepath.Join(gameDir, "passwd.dll")); !os.IsNotExist(err) {
+		t.Errorf("symlink entry was written to the game folder (Lstat: %v)", err)
+	}
+}
+
+func TestArchiveUnsafePath(t *testing.T) {
+	archive := writeZip(t, []string{"MHWILDS/dinput8.dll", "MHWILDS/../evil.dll"}, nil)
+	parent := t.TempDir()
+	gameDir := filepath.Join(parent, "game")
+	if err := os.Mkdir(gameDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err := Archive(archive, gameDir, "MHWILDS/", "")
+	if err == nil || !strings.Contains(err.Error(), "unsafe path in archive: MHWILDS/../evil.dll") {
+		t.Fatalf("err = %v, want an unsafe path error naming the entry", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.dll")); !os.IsNotExist(err) {
+		t.Errorf("evil.dll was written outside the game folder (Stat: %v)", err)
+	}
+}
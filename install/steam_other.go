@@ -0,0 +1,21 @@
+//go:build !windows
+
+package install
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// steamRoots lists where Steam is installed by default: ~/.steam/steam and
+// ~/.local/share/Steam, where Proton runs the game.
+func steamRoots() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".steam", "steam"),
+		filepath.Join(home, ".local", "share", "Steam"),
+	}
+}
@@ -0,0 +1,25 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// steamRoots lists where Steam is installed: the folder its registry key
+// names, then the default under Program Files (x86).
+func steamRoots() []string {
+	var roots []string
+	if k, err := registry.OpenKey(registry.CURRENT_USER, `Software\Valve\Steam`, registry.QUERY_VALUE); err == nil {
+		if p, _, err := k.GetStringValue("SteamPath"); err == nil && p != "" {
+			roots = append(roots, filepath.Clean(p))
+		}
+		k.Close()
+	}
+	pf := os.Getenv("ProgramFiles(x86)")
+	if pf == "" {
+		pf = `C:\Program Files (x86)`
+	}
+	return append(roots, filepath.Join(pf, "Steam"))
+}
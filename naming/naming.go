@@ -0,0 +1,266 @@
+// Package naming names the archives the builders write and finds the ones
+// an earlier run wrote, so -prune can delete all but the newest.
+package naming
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"buildREFramework/release"
+	"buildREFramework/stamp"
+)
+
+// DefaultTemplate gives the REFramework_<version>_<date>.zip names the
+// shell script used.
+const DefaultTemplate = "REFramework_{version}_{date:02Jan06}{variant}.zip"
+
+// Fields are the values a name template's placeholders expand to.
+type Fields struct {
+	Tag, Num, Hash, Version string
+	Date                    time.Time
+}
+
+// ReleaseFields are the fields for an archive built from the release tagged
+// tag. A nightly's version is nightly-<num>-<hash> with the hash shortened,
+// as the shell script named them; any other tag is its own version.
+func ReleaseFields(tag string, published time.Time) Fields {
+	f := Fields{Tag: tag, Version: tag, Date: published}
+	if num, hash, ok := release.ParseTag(tag); ok {
+		f.Num, f.Hash = num, release.ShortHash(hash)
+		f.Version = fmt.Sprintf("nightly-%s-%s", num, f.Hash)
+	}
+	return f
+}
+
+// localRe finds a nightly tag, and the date of a previously built archive,
+// in the name of a local source archive.
+var localRe = regexp.MustCompile(`nightly-(\d{4,})-([A-Za-z0-9]+)(?:_(\d{2}[A-Za-z]{3}\d{2}))?`)
+
+// LocalFields are the fields for an archive built from a local file with
+// the given base name (without extension) and modtime. The version, and
+// date for previously built archives, come from a nightly tag in the name;
+// otherwise the version is "local" and the date the modtime.
+func LocalFields(base string, modTime time.Time) Fields {
+	f := Fields{Version: "local", Date: modTime}
+	if m := localRe.FindStringSubmatch(base); len(m) == 4 {
+		f.Num, f.Hash = m[1], release.ShortHash(m[2])
+		f.Version = fmt.Sprintf("nightly-%s-%s", m[1], f.Hash)
+		if t, err := time.Parse("02Jan06", m[3]); err == nil {
+			f.Date = t
+		}
+	}
+	return f
+}
+
+// Scheme is how one run names its archives: the template and what its
+// {prefix} and {variant} placeholders stand for.
+type Scheme struct {
+	Template string
+	Prefix   string // {prefix}: the archive prefix
+	Variant  string // {variant}: _<game>, _full, _<profile>, both or nothing
+}
+
+var placeholderRe = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// Name expands the placeholders in the template:
+//
+//	{version}  nightly-<num>-<hash> for nightlies, else the tag ("local" for -input)
+//	{tag}      the full release tag (empty for -input)
+//	{num}      the numeric version (empty if the tag has none)
+//	{hash}     the commit hash, shortened to 6 characters
+//	{date}     the publish date as 02Jan06, or {date:layout} with a Go layout
+//	{prefix}   s.Prefix
+//	{variant}  s.Variant
+//
+// A .zip extension is added if the result has none. The result must be a
+// plain file name that Windows accepts too.
+func (s Scheme) Name(f Fields) (string, error) {
+	var unknown string
+	name := placeholderRe.ReplaceAllStringFunc(s.Template, func(p string) string {
+		m := placeholderRe.FindStringSubmatch(p)
+		switch m[1] {
+		case "version":
+			return f.Version
+		case "tag":
+			return f.Tag
+		case "num":
+			return f.Num
+		case "hash":
+			return f.Hash
+		case "date":
+			if m[2] == "" {
+				return f.Date.Format("02Jan06")
+			}
+			return f.Date.Format(m[2])
+		case "prefix":
+			return s.Prefix
+		case "variant":
+			return s.Variant
+		}
+		if unknown == "" {
+			unknown = p
+		}
+		return p
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in name template %q", unknown, s.Template)
+	}
+	if !strings.HasSuffix(name, ".zip") {
+		name += ".zip"
+	}
+	if err := CheckFileName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Check renders the template with sample values so a bad template is
+// reported before anything is downloaded.
+func (s Scheme) Check() error {
+	sample := Fields{Tag: "nightly-01234-abcdef0", Num: "01234", Hash: "abcdef", Version: "nightly-01234-abcdef", Date: time.Now()}
+	_, err := s.Name(sample)
+	return err
+}
+
+// CheckFileName rejects names that would land outside the output dir or
+// that Windows can't store: path separators, reserved characters, control
+// characters and a missing stem.
+func CheckFileName(name string) error {
+	stem := strings.TrimSuffix(name, ".zip")
+	switch {
+	case stem == "":
+		return fmt.Errorf("output name %q has nothing before the extension", name)
+	case strings.ContainsAny(name, `/\<>:"|?*`):
+		return fmt.Errorf("output name %q contains a path separator or a character Windows doesn't allow in file names", name)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("output name %q contains a control character", name)
+	case strings.HasSuffix(stem, ".") || strings.HasSuffix(stem, " "):
+		return fmt.Errorf("output name %q ends its stem in a dot or space", name)
+	}
+	return nil
+}
+
+// WithFormat swaps the .zip extension of an output name for the format's.
+func WithFormat(name, format string) string {
+	if format == "tgz" {
+		return strings.TrimSuffix(name, ".zip") + ".tar.gz"
+	}
+	return name
+}
+
+// Glob turns the template into a glob matching the names it renders in
+// format, every placeholder becoming *.
+func (s Scheme) Glob(format string) string {
+	glob := placeholderRe.ReplaceAllString(s.Template, "*")
+	if !strings.HasSuffix(glob, ".zip") {
+		glob += ".zip"
+	}
+	return WithFormat(glob, format)
+}
+
+// Pattern matches the names the template renders for this scheme, so a
+// stripped build never prunes _full, _<profile> or _<game> ones (nor the
+// other way round). {variant} and {prefix} must match the scheme's, a
+// 02Jan06 {date} is captured as "date", and any other placeholder matches
+// anything. The extension is the one format gives the name.
+func (s Scheme) Pattern(format string) *regexp.Regexp {
+	tmpl := s.Template
+	if !strings.HasSuffix(tmpl, ".zip") {
+		tmpl += ".zip"
+	}
+	tmpl = WithFormat(tmpl, format)
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(tmpl, -1) {
+		b.WriteString(regexp.QuoteMeta(tmpl[last:m[0]]))
+		last = m[1]
+		layout := ""
+		if m[4] >= 0 {
+			layout = tmpl[m[4]:m[5]]
+		}
+		switch name := tmpl[m[2]:m[3]]; {
+		case name == "variant":
+			b.WriteString(regexp.QuoteMeta(s.Variant))
+		case name == "prefix":
+			b.WriteString(regexp.QuoteMeta(s.Prefix))
+		case name == "date" && (layout == "" || layout == "02Jan06"):
+			b.WriteString(`(?P<date>\d{2}[A-Za-z]{3}\d{2})`)
+		default:
+			b.WriteString(".*")
+		}
+	}
+	b.WriteString(regexp.QuoteMeta(tmpl[last:]) + "$")
+	return regexp.MustCompile(b.String())
+}
+
+// Prune deletes all but the newest keep archives in dir that match the
+// scheme in current's format (see Pattern). They are ordered newest first
+// by the publish date in the name; modtime breaks ties and stands in when
+// there is no date. The archive named current is never deleted. It returns
+// the paths that were removed.
+//
+// With a template other than DefaultTemplate, only matching names with a
+// .source.json stamp beside them are candidates, so files the builder
+// didn't write are never touched.
+func (s Scheme) Prune(dir string, keep int, current string) ([]string, error) {
+	custom, format := s.Template != DefaultTemplate, "zip"
+	if strings.HasSuffix(current, ".tar.gz") {
+		format = "tgz"
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, s.Glob(format)))
+	if err != nil {
+		return nil, err
+	}
+
+	type archive struct {
+		path    string
+		date    time.Time
+		modTime time.Time
+	}
+	nameRe := s.Pattern(format)
+	archives := make([]archive, 0, len(paths))
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		m := nameRe.FindStringSubmatch(filepath.Base(p))
+		if err != nil || fi.IsDir() || m == nil {
+			continue
+		}
+		if _, err := os.Stat(stamp.Path(p)); custom && err != nil {
+			continue
+		}
+		a := archive{path: p, date: fi.ModTime(), modTime: fi.ModTime()}
+		if i := nameRe.SubexpIndex("date"); i > 0 {
+			if t, err := time.Parse("02Jan06", m[i]); err == nil {
+				a.date = t
+			}
+		}
+		archives = append(archives, a)
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		if !archives[i].date.Equal(archives[j].date) {
+			return archives[i].date.After(archives[j].date)
+		}
+		return archives[i].modTime.After(archives[j].modTime)
+	})
+
+	var removed []string
+	for i, a := range archives {
+		if i < keep || filepath.Base(a.path) == filepath.Base(current) {
+			continue
+		}
+		if err := os.Remove(a.path); err != nil {
+			return removed, err
+		}
+		os.Remove(a.path + ".sha256")
+		os.Remove(stamp.Path(a.path))
+		removed = append(removed, a.path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,227 @@
+// Package release holds the GitHub releases the builders list and build
+// from, and the rules for ordering them and for picking one from what the
+// user typed.
+package release
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release is one GitHub release as the API lists it.
+type Release struct {
+	TagName     string    `json:"tag_name"`
+	PublishedAt time.Time `json:"published_at"`
+	Body        string    `json:"body"`
+	Assets      []Asset   `json:"assets"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+
+	// Raw is the release exactly as the API sent it, for -debug-json. Fields
+	// missing from it just stay zero: a release without assets has none to
+	// build, one without a publish date isn't listed.
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes a release and keeps its JSON in Raw.
+func (r *Release) UnmarshalJSON(data []byte) error {
+	type plain Release // without this method, so Unmarshal doesn't recurse
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Decode parses a release list response body. A body that isn't a JSON
+// array, such as the error object GitHub sends during an incident, is an
+// error carrying the API's message when there is one.
+func Decode(data []byte) ([]Release, error) {
+	var releases []Release
+	err := json.Unmarshal(data, &releases)
+	if err == nil && releases != nil {
+		return releases, nil
+	}
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	switch {
+	case json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "":
+		return nil, fmt.Errorf("GitHub API error: %s", apiErr.Message)
+	case strings.TrimSpace(string(data)) == "":
+		return nil, errors.New("GitHub API returned an empty release list body")
+	case err == nil: // a JSON null
+		return nil, errors.New("GitHub API returned no release list")
+	}
+	return nil, fmt.Errorf("decoding the release list: %w", err)
+}
+
+// Asset is a file attached to a release. Digest ("sha256:...") is only set
+// by newer API responses.
+type Asset struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Listable reports whether r belongs in the version list: published (not a
+// draft, and with a publish date to sort by) and, unless includePre, not a
+// prerelease.
+func Listable(r Release, includePre bool) bool {
+	return !r.Draft && !r.PublishedAt.IsZero() && (includePre || !r.Prerelease)
+}
+
+// nightlyRe matches a nightly-<num>-<hash> tag.
+var nightlyRe = regexp.MustCompile(`^nightly-(\d{4,})-([A-Za-z0-9]+)$`)
+
+// ParseTag splits a nightly-<num>-<hash> tag into its build number and
+// commit hash. It returns false for any other tag.
+func ParseTag(tag string) (num, hash string, ok bool) {
+	m := nightlyRe.FindStringSubmatch(tag)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// ShortHash is hash shortened to the 6 characters archive names use.
+func ShortHash(hash string) string {
+	if len(hash) > 6 {
+		return hash[:6]
+	}
+	return hash
+}
+
+// Info describes a nightly for the summary: its build number and commit
+// (short, as in the file name, and in full), plus when the release was
+// published. It returns "" for tags that aren't nightly-<num>-<hash>.
+func Info(tag string, published time.Time) string {
+	num, hash, ok := ParseTag(tag)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("Build number: %s, Commit: %s, Published: %s\nFull commit: %s",
+		num, ShortHash(hash), published.UTC().Format("2006-01-02 15:04 UTC"), hash)
+}
+
+// Less orders releases for a version menu: "date" is newest first, "asc"
+// oldest first and "version" highest nightly number first.
+func Less(a, b Release, mode string) bool {
+	switch mode {
+	case "asc":
+		return a.PublishedAt.Before(b.PublishedAt)
+	case "version":
+		return TagNumber(a.TagName) > TagNumber(b.TagName)
+	default:
+		return a.PublishedAt.After(b.PublishedAt)
+	}
+}
+
+// TagNumber returns the numeric version of a nightly-<num>-<hash> tag, or 0.
+func TagNumber(tag string) int {
+	m := regexp.MustCompile(`^nightly-(\d+)-`).FindStringSubmatch(tag)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// Pick turns an answer to the version prompt into a 1-based index into
+// rels: empty means 1 and a number up to limit is a menu entry. An exact
+// version or tag picks that release; anything else is looked for in the
+// tags and publish dates of all of rels. Several matches are an error that
+// lists them.
+func Pick(rels []Release, limit int, input string) (int, error) {
+	if input == "" {
+		return 1, nil
+	}
+	if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= limit {
+		return n, nil
+	}
+	for i, r := range rels {
+		if r.TagName == input || strings.HasPrefix(r.TagName, "nightly-"+input+"-") {
+			return i + 1, nil
+		}
+	}
+	var matches []int
+	for i, r := range rels {
+		if strings.Contains(r.TagName, input) || strings.Contains(r.PublishedAt.Format("2006-01-02 15:04:05"), input) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no release matches %q", input)
+	case 1:
+		return matches[0] + 1, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q matches %d releases:", input, len(matches))
+	for _, i := range matches {
+		fmt.Fprintf(&b, "\n  %s  %s", rels[i].TagName, rels[i].PublishedAt.Format("2006-01-02 15:04:05"))
+	}
+	return 0, errors.New(b.String())
+}
+
+// DateRange limits the offered releases by publish date. A zero bound is
+// open.
+type DateRange struct {
+	After, Before time.Time
+}
+
+// ParseDateRange parses the after and before dates (YYYY-MM-DD, UTC). The
+// names are how the user set them, such as -after or AFTER, for the errors.
+func ParseDateRange(afterName, after, beforeName, before string) (DateRange, error) {
+	var r DateRange
+	var err error
+	if r.After, err = ParseDate(afterName, after); err != nil {
+		return r, err
+	}
+	if r.Before, err = ParseDate(beforeName, before); err != nil {
+		return r, err
+	}
+	if !r.After.IsZero() && !r.Before.IsZero() && !r.After.Before(r.Before) {
+		return r, fmt.Errorf("%s %s is not before %s %s", afterName, after, beforeName, before)
+	}
+	return r, nil
+}
+
+// ParseDate parses a YYYY-MM-DD value of the setting name; empty gives the
+// zero time.
+func ParseDate(name, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s takes a date like 2025-02-01, got %q", name, s)
+	}
+	return t, nil
+}
+
+// IsZero reports whether neither bound is set.
+func (r DateRange) IsZero() bool {
+	return r.After.IsZero() && r.Before.IsZero()
+}
+
+// Contains reports whether t is on or after After and before Before.
+func (r DateRange) Contains(t time.Time) bool {
+	return (r.After.IsZero() || !t.Before(r.After)) && (r.Before.IsZero() || t.Before(r.Before))
+}
+
+func (r DateRange) String() string {
+	switch {
+	case r.After.IsZero():
+		return "before " + r.Before.Format("2006-01-02")
+	case r.Before.IsZero():
+		return "on or after " + r.After.Format("2006-01-02")
+	}
+	return "on or after " + r.After.Format("2006-01-02") + " and before " + r.Before.Format("2006-01-02")
+}
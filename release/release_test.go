@@ -0,0 +1,52 @@
+package release
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPick(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.DateTime, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// Newest first, as listed
+	rels := []Release{
+		{TagName: "nightly-01203-4e8a1f2", PublishedAt: date("2025-03-14 02:10:00")},
+		{TagName: "nightly-01202-9c0d3b7", PublishedAt: date("2025-03-13 02:10:00")},
+		{TagName: "nightly-01201-77ab210", PublishedAt: date("2025-03-12 02:10:00")},
+		{TagName: "v1.5.9", PublishedAt: date("2025-02-01 18:00:00")},
+	}
+	tests := []struct {
+		name  string
+		limit int
+		input string
+		want  int
+		err   string // part of the error, "" for none
+	}{
+		{"empty input", 3, "", 1, ""},
+		{"menu index", 3, "2", 2, ""},
+		{"exact tag", 3, "v1.5.9", 4, ""},
+		{"version number", 3, "01201", 3, ""},
+		{"date substring", 3, "2025-03-13", 2, ""},
+		{"hash substring", 3, "77ab", 3, ""},
+		{"ambiguous", 3, "2025-03", 0, `"2025-03" matches 3 releases:`},
+		{"no match", 3, "zzz", 0, `no release matches "zzz"`},
+	}
+	for _, tt := range tests {
+		got, err := Pick(rels, tt.limit, tt.input)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Pick(%q) error = %v, want one containing %q", tt.name, tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Pick(%q) = %d, %v, want %d", tt.name, tt.input, got, err, tt.want)
+		}
+	}
+}
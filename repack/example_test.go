@@ -0,0 +1,62 @@
+package repack_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"buildREFramework/repack"
+)
+
+// nightly is a small stand-in for a REFramework nightly zip.
+func nightly() *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"dinput8.dll", "openvr_api.dll", "reframework/plugins/", "reframework/plugins/vr.lua"} {
+		w, _ := zw.Create(name)
+		if name[len(name)-1] != '/' {
+			fmt.Fprintf(w, "contents of %s", name)
+		}
+	}
+	zw.Close()
+	return bytes.NewReader(buf.Bytes())
+}
+
+// A handler can stream the filtered archive straight into its response,
+// with nothing written to disk in between.
+func ExampleTranscodeStream() {
+	src := nightly()
+	filters, err := repack.NewFilterSet([]string{"openvr", "vr.lua"}, false)
+	if err != nil {
+		panic(err)
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		stats, err := repack.TranscodeStream(r.Context(), src, src.Size(), w, &filters, repack.Options{Prefix: "MHWILDS"})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("kept %d, removed %d\n", stats.Kept, stats.Removed)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequestWithContext(context.Background(), "GET", "/MHWILDS.zip", nil))
+
+	body := rec.Body.Bytes()
+	out, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range out.File {
+		fmt.Println(f.Name)
+	}
+	// Output:
+	// kept 1, removed 2
+	// MHWILDS/
+	// MHWILDS/dinput8.dll
+	// MHWILDS/reframework/plugins/
+}
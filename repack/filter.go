@@ -0,0 +1,119 @@
+package repack
+
+import (
+	"archive/zip"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// FilterSet decides which source entries are dropped. By default an entry is
+// dropped when its name contains any pattern; with KeepOnly the logic is
+// inverted and only entries containing a pattern are kept. A pattern written
+// as "re:<expr>" is matched as a regular expression instead of a substring.
+// Build one with NewFilterSet so the patterns are validated.
+type FilterSet struct {
+	Patterns []string
+	KeepOnly bool
+	OnlyDirs []string // if set, only entries under these top-level names are kept
+	regexps  map[string]*regexp.Regexp
+}
+
+// NewFilterSet validates patterns and compiles the "re:" ones. It rejects
+// empty patterns, patterns made only of slashes and dots (a lone "/" drops
+// every file in a subfolder), and regexps that match the empty string and so
+// match every entry.
+func NewFilterSet(patterns []string, keepOnly bool) (FilterSet, error) {
+	fs := FilterSet{Patterns: patterns, KeepOnly: keepOnly}
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fs, fmt.Errorf("empty filter pattern in %q", strings.Join(patterns, ","))
+		}
+		if expr, ok := strings.CutPrefix(p, "re:"); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fs, fmt.Errorf("filter pattern %q: %w", p, err)
+			}
+			if re.MatchString("") {
+				return fs, fmt.Errorf("filter pattern %q matches every entry", p)
+			}
+			if fs.regexps == nil {
+				fs.regexps = make(map[string]*regexp.Regexp)
+			}
+			fs.regexps[p] = re
+			continue
+		}
+		if strings.Trim(p, `/\.`) == "" {
+			return fs, fmt.Errorf("filter pattern %q matches nearly every entry", p)
+		}
+	}
+	return fs, nil
+}
+
+func (fs FilterSet) String() string {
+	s := "exclude: " + strings.Join(fs.Patterns, ", ")
+	switch {
+	case len(fs.Patterns) == 0:
+		s = "nothing removed"
+	case fs.KeepOnly:
+		s = "keep only: " + strings.Join(fs.Patterns, ", ")
+	}
+	if len(fs.OnlyDirs) > 0 {
+		s = "only " + strings.Join(fs.OnlyDirs, ", ") + "; " + s
+	}
+	return s
+}
+
+// KeepFunc decides entry by entry what goes into a built archive: returning
+// false drops the entry. It sees each source entry once, in archive order,
+// with its name as stored in the source (backslashes turned into slashes)
+// and can open it to look at the content. Dropped files still count as
+// Removed in the Stats and in the metadata entry. FilterSet.Keep is the
+// KeepFunc the builder itself uses.
+type KeepFunc func(entry *zip.File) bool
+
+// Keep returns fs as a KeepFunc: an entry is kept unless Match drops its
+// name with root, the folder SourceRoot found for the archive, stripped.
+func (fs FilterSet) Keep(root string) KeepFunc {
+	return func(f *zip.File) bool {
+		drop, _ := fs.Match(strings.TrimPrefix(f.Name, root))
+		return !drop
+	}
+}
+
+// Match reports whether the entry name should be dropped from the output,
+// and the rule that decided it: the first pattern the name matches, or
+// NoKeepRule (keep mode, nothing matched) or OnlyDirsRule. The rule is ""
+// when no rule applied. Entries outside OnlyDirs are dropped first; past
+// that gate, an empty filter set keeps everything, in either mode.
+func (fs FilterSet) Match(name string) (drop bool, rule string) {
+	if len(fs.OnlyDirs) > 0 {
+		top, _, _ := strings.Cut(name, "/")
+		if !slices.Contains(fs.OnlyDirs, top) {
+			return true, OnlyDirsRule
+		}
+	}
+	if len(fs.Patterns) == 0 {
+		return false, ""
+	}
+	for _, p := range fs.Patterns {
+		if re := fs.regexps[p]; re != nil {
+			if re.MatchString(name) {
+				return !fs.KeepOnly, p
+			}
+		} else if strings.Contains(name, p) {
+			return !fs.KeepOnly, p
+		}
+	}
+	if fs.KeepOnly {
+		return true, NoKeepRule
+	}
+	return false, ""
+}
+
+// The rules Match gives for drops that no single pattern caused.
+const (
+	OnlyDirsRule = "outside -only-dirs"
+	NoKeepRule   = "no -keep pattern"
+)
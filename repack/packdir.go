@@ -0,0 +1,81 @@
+package repack
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// PackDir writes the folder dir to dest as an uncompressed zip with an
+// entry per file and per folder (so empty folders survive), named by the
+// path relative to dir. Symlinks and other special files are skipped and,
+// if warnf is set, reported to it. Entries come in filepath.WalkDir's
+// lexical order, each folder before its contents, so a folder always packs
+// the same way on every platform.
+func PackDir(ctx context.Context, dir, dest string, warnf func(format string, args ...any)) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	bw := bufio.NewWriterSize(out, bufSize)
+	zw := zip.NewWriter(bw)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			if warnf != nil {
+				warnf("skipping %s (not a regular file)", path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Method = zip.Store
+		if d.IsDir() {
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,404 @@
+// Package repack rewrites a REFramework nightly zip as a filtered archive:
+// entries a FilterSet (or any KeepFunc) drops are left out and the rest are
+// placed under a prefix folder. It streams from an io.ReaderAt to an
+// io.Writer and never touches the filesystem, so the output can go to a
+// file, a pipe or an HTTP response alike.
+package repack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"buildREFramework/report"
+)
+
+// Stats summarizes a repack: files kept and removed, the total
+// uncompressed size of the kept files, and the size of the output archive.
+type Stats struct {
+	Kept         int
+	Removed      int
+	Uncompressed uint64
+	Written      int64
+}
+
+// ErrEmptyArchive is returned instead of finishing an archive that would
+// hold nothing but the prefix folder.
+var ErrEmptyArchive = errors.New("all entries were filtered out — check your filter patterns")
+
+// Options shape the output archive. The zero value puts the kept entries
+// at the top level with their own times, no comment and no metadata entry.
+type Options struct {
+	// Prefix is the folder every entry is placed under, such as "MHWILDS";
+	// "" puts the entries at the top level.
+	Prefix string
+	// SourceRoot is a folder some sources already wrap everything in, with
+	// its trailing slash. When every entry is under it, it is stripped
+	// instead of ending up inside Prefix a second time.
+	SourceRoot string
+	// EntryTime, if set, replaces the modification time of every entry and
+	// pins the deflate level, so the same input always gives the same bytes.
+	EntryTime time.Time
+	// Comment is the zip comment of the output.
+	Comment string
+	// MetaData, if set, returns the content of an entry written under
+	// Prefix as MetaName after all the others, given the final Stats. A
+	// source entry by that name is dropped, uncounted, so the output never
+	// holds two.
+	MetaName string
+	MetaData func(Stats) ([]byte, error)
+	// Reporter gets the progress entry by entry and the skipped entries;
+	// nil reports nothing.
+	Reporter report.Reporter
+	// Debugf, if set, logs each entry the KeepFunc drops.
+	Debugf func(format string, args ...any)
+	// Warnf, if set, reports the symlink and duplicate entries that are
+	// skipped; otherwise they go to Reporter as "Warning: ..." lines.
+	Warnf func(format string, args ...any)
+}
+
+// bufSize is the buffer on both ends of an entry copy, so large entries
+// move in a few big reads and writes.
+const bufSize = 1 << 20
+
+// TranscodeStream repacks the zip archive in src (size bytes long) into w,
+// leaving out the entries fs filters (nil filters nothing). The source's
+// comment is kept unless opts sets one. It stops with ctx.Err() once ctx is
+// cancelled. On error, w may hold a partial archive.
+func TranscodeStream(ctx context.Context, src io.ReaderAt, size int64, w io.Writer, fs *FilterSet, opts Options) (Stats, error) {
+	var filters FilterSet
+	if fs != nil {
+		filters = *fs
+	}
+	return transcodeReaderAt(ctx, src, size, w, func(root string) KeepFunc { return filters.Keep(root) }, opts)
+}
+
+// TranscodeStreamFunc is TranscodeStream with keep deciding which entries
+// go into the output instead of a FilterSet; nil keeps everything. To
+// build on the usual filtering, call the FilterSet's Keep from keep.
+func TranscodeStreamFunc(ctx context.Context, src io.ReaderAt, size int64, w io.Writer, keep KeepFunc, opts Options) (Stats, error) {
+	return transcodeReaderAt(ctx, src, size, w, func(string) KeepFunc { return keep }, opts)
+}
+
+// transcodeReaderAt opens src for TranscodeStream and TranscodeStreamFunc
+// and repacks it with the KeepFunc that newKeep returns for its root.
+func transcodeReaderAt(ctx context.Context, src io.ReaderAt, size int64, w io.Writer, newKeep func(root string) KeepFunc, opts Options) (Stats, error) {
+	r, err := zip.NewReader(src, size)
+	if err != nil {
+		return Stats{}, err
+	}
+	NormalizeNames(r.File)
+	if opts.Comment == "" {
+		opts.Comment = r.Comment
+	}
+	return Zip(ctx, r, w, newKeep(SourceRoot(r.File, opts.SourceRoot)), opts)
+}
+
+// Zip writes the entries of r that keep accepts (all of them if keep is
+// nil) to w as a new zip, followed by the metadata entry if opts has one.
+// It checks ctx before each entry and returns ctx.Err() once it is
+// cancelled.
+func Zip(ctx context.Context, r *zip.Reader, w io.Writer, keep KeepFunc, opts Options) (Stats, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriterSize(cw, bufSize)
+	zw := zip.NewWriter(bw)
+	defer zw.Close()
+	if err := zw.SetComment(opts.Comment); err != nil {
+		return Stats{}, fmt.Errorf("set comment: %w", err)
+	}
+	if !opts.EntryTime.IsZero() {
+		// Pin the deflate level so output doesn't depend on library defaults
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		})
+	}
+
+	stats, err := opts.repack(ctx, r, keep, archiveWriter{
+		dir: func(name string, f *zip.File) error {
+			var err error
+			if f == nil {
+				_, err = zw.Create(name)
+			} else {
+				_, err = zw.CreateHeader(dirHeader(name, opts.modTime(f.Modified)))
+			}
+			return err
+		},
+		file: func(name string, f *zip.File, br *bufio.Reader) error {
+			dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: opts.modTime(f.Modified)})
+			if err != nil {
+				return fmt.Errorf("create header %s: %w", f.Name, err)
+			}
+			return copyEntry(dst, f, br)
+		},
+		data: func(name string, data []byte) error {
+			dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: opts.modTime(time.Now())})
+			if err != nil {
+				return fmt.Errorf("create header %s: %w", name, err)
+			}
+			if _, err := dst.Write(data); err != nil {
+				return fmt.Errorf("write %s: %w", name, err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := zw.Close(); err != nil {
+		return stats, fmt.Errorf("close zip writer: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return stats, fmt.Errorf("flush archive: %w", err)
+	}
+	stats.Written = cw.n
+	return stats, nil
+}
+
+// TarGz is Zip writing a gzip-compressed tarball instead, which keeps the
+// source file modes.
+func TarGz(ctx context.Context, r *zip.Reader, w io.Writer, keep KeepFunc, opts Options) (Stats, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriterSize(cw, bufSize)
+	gz := gzip.NewWriter(bw)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	stats, err := opts.repack(ctx, r, keep, archiveWriter{
+		dir: func(name string, f *zip.File) error {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755, ModTime: opts.modTime(time.Now())}
+			if f != nil {
+				hdr.ModTime = opts.modTime(f.Modified)
+				if perm := f.Mode().Perm(); perm != 0 {
+					hdr.Mode = int64(perm)
+				}
+			}
+			return tw.WriteHeader(hdr)
+		},
+		file: func(name string, f *zip.File, br *bufio.Reader) error {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: int64(f.Mode().Perm()), Size: int64(f.UncompressedSize64), ModTime: opts.modTime(f.Modified)}
+			if hdr.Mode == 0 {
+				hdr.Mode = 0644
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return fmt.Errorf("create header %s: %w", f.Name, err)
+			}
+			return copyEntry(tw, f, br)
+		},
+		data: func(name string, data []byte) error {
+			hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: opts.modTime(time.Now())}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return fmt.Errorf("create header %s: %w", name, err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				return fmt.Errorf("write %s: %w", name, err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := tw.Close(); err != nil {
+		return stats, fmt.Errorf("close tar writer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return stats, fmt.Errorf("close gzip writer: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return stats, fmt.Errorf("flush archive: %w", err)
+	}
+	stats.Written = cw.n
+	return stats, nil
+}
+
+// archiveWriter adds entries to one output format for repack: a folder (f
+// is nil for the prefix folder), a file copied from the source, and a file
+// with the given content.
+type archiveWriter struct {
+	dir  func(name string, f *zip.File) error
+	file func(name string, f *zip.File, br *bufio.Reader) error
+	data func(name string, data []byte) error
+}
+
+// repack walks the entries of r and hands the ones keep accepts to aw under
+// their output names, then the metadata entry. It is the part Zip and TarGz
+// share.
+func (o Options) repack(ctx context.Context, r *zip.Reader, keep KeepFunc, aw archiveWriter) (Stats, error) {
+	var stats Stats
+	rep := o.Reporter
+	if rep == nil {
+		rep = report.NopReporter{}
+	}
+	seen := make(map[string]bool)
+	if o.Prefix != "" {
+		if err := aw.dir(o.prefixed(""), nil); err != nil {
+			return stats, fmt.Errorf("create root dir: %w", err)
+		}
+		seen[o.prefixed("")] = true
+	}
+	root := SourceRoot(r.File, o.SourceRoot)
+	br := bufio.NewReaderSize(nil, bufSize)
+
+	for i, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		rel := strings.TrimPrefix(f.Name, root)
+		report.EntryProgress(rep, rel, float64(i+1)/float64(len(r.File)))
+		if rel == "" || (o.MetaData != nil && rel == o.MetaName) {
+			continue
+		}
+		if keep != nil && !keep(f) {
+			if o.Debugf != nil {
+				o.Debugf("filtered out: %s", f.Name)
+			}
+			if !f.FileInfo().IsDir() {
+				stats.Removed++
+			}
+			continue
+		}
+
+		// Symlinks would be copied as regular files holding the target path
+		if f.Mode()&os.ModeSymlink != 0 {
+			o.warnf(rep, "skipping symlink entry %s", f.Name)
+			continue
+		}
+		name := o.prefixed(rel)
+		if seen[name] {
+			o.warnf(rep, "skipping duplicate entry %s", f.Name)
+			continue
+		}
+		seen[name] = true
+		// Kept as real directory entries so empty folders survive
+		if f.FileInfo().IsDir() {
+			if err := aw.dir(name, f); err != nil {
+				return stats, fmt.Errorf("create header %s: %w", f.Name, err)
+			}
+			continue
+		}
+		if err := aw.file(name, f, br); err != nil {
+			return stats, err
+		}
+		stats.Kept++
+		stats.Uncompressed += f.UncompressedSize64
+	}
+	if stats.Kept == 0 {
+		return stats, ErrEmptyArchive
+	}
+	// Written here rather than copied from the source, so the filters
+	// never see it
+	if o.MetaData != nil {
+		data, err := o.MetaData(stats)
+		if err != nil {
+			return stats, err
+		}
+		if err := aw.data(o.prefixed(o.MetaName), data); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// warnf reports a skipped entry to Warnf, or to rep without one.
+func (o Options) warnf(rep report.Reporter, format string, args ...any) {
+	if o.Warnf != nil {
+		o.Warnf(format, args...)
+		return
+	}
+	rep.Log("Warning: " + fmt.Sprintf(format, args...))
+}
+
+// prefixed returns rel placed under the Prefix folder.
+func (o Options) prefixed(rel string) string {
+	if o.Prefix == "" {
+		return rel
+	}
+	return o.Prefix + "/" + rel
+}
+
+// modTime returns t, or EntryTime when it is set.
+func (o Options) modTime(t time.Time) time.Time {
+	if !o.EntryTime.IsZero() {
+		return o.EntryTime
+	}
+	return t
+}
+
+// NormalizeNames turns backslashes in entry names into forward slashes. The
+// zip spec only allows "/", but some Windows tools write backslashes, and
+// such a name would otherwise dodge the filters and the prefix and end up
+// as one long file name. The stream functions do this themselves; callers
+// that open a *zip.Reader for Zip or TarGz should do it first.
+func NormalizeNames(files []*zip.File) {
+	for _, f := range files {
+		f.Name = strings.ReplaceAll(f.Name, `\`, "/")
+	}
+}
+
+// SourceRoot returns dir if every one of files is already under it, so it
+// can be stripped instead of being prefixed a second time
+// (MHWILDS/MHWILDS/...). Otherwise, or if dir is "", it returns "".
+func SourceRoot(files []*zip.File, dir string) string {
+	if len(files) == 0 || dir == "" {
+		return ""
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, dir) {
+			return ""
+		}
+	}
+	return dir
+}
+
+// dirHeader is the header of a directory entry: stored, no data, and
+// marked as a folder for extractors that go by the mode rather than the
+// trailing slash.
+func dirHeader(name string, modified time.Time) *zip.FileHeader {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modified}
+	h.SetMode(os.ModeDir | 0755)
+	return h
+}
+
+// copyEntry streams the source entry f to w through br. archive/zip checks
+// the CRC-32 only at the end of the data, so a short copy is an error too,
+// as is a failed Close; either names the entry.
+func copyEntry(w io.Writer, f *zip.File, br *bufio.Reader) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open entry %s: %w", f.Name, err)
+	}
+	br.Reset(rc)
+	n, err := io.Copy(w, br)
+	if cerr := rc.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && uint64(n) != f.UncompressedSize64 {
+		err = fmt.Errorf("copied %d of %d bytes", n, f.UncompressedSize64)
+	}
+	if err != nil {
+		return fmt.Errorf("copy entry %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
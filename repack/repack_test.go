@@ -0,0 +1,405 @@
+package repack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"buildREFramework/report"
+)
+
+// entry is one entry of a test source zip; a name ending in "/" is a
+// directory.
+type entry struct {
+	name, body string
+}
+
+// makeZip builds a source zip holding entries, with the given comment.
+func makeZip(t testing.TB, comment string, entries ...entry) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, e.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestAllFiltered(t *testing.T) {
+	src := makeZip(t, "", entry{"openvr_api.dll", "x"}, entry{"reframework/", ""}, entry{"reframework/vr.lua", "x"})
+	fs, err := NewFilterSet([]string{"vr"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := TranscodeStream(context.Background(), src, src.Size(), io.Discard, &fs, Options{Prefix: "MHWILDS"})
+	if !errors.Is(err, ErrEmptyArchive) {
+		t.Fatalf("err = %v, want ErrEmptyArchive", err)
+	}
+	if stats.Kept != 0 || stats.Removed != 2 {
+		t.Errorf("stats = %+v, want 0 kept and 2 removed", stats)
+	}
+}
+
+// transcode runs TranscodeStream on src and opens the result.
+func transcode(t *testing.T, src *bytes.Reader, fs *FilterSet, opts Options) (*zip.Reader, Stats) {
+	t.Helper()
+	var out bytes.Buffer
+	stats, err := TranscodeStream(context.Background(), src, src.Size(), &out, fs, opts)
+	if err != nil {
+		t.Fatalf("TranscodeStream: %v", err)
+	}
+	if stats.Written != int64(out.Len()) {
+		t.Errorf("Written = %d, want %d", stats.Written, out.Len())
+	}
+	r, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	return r, stats
+}
+
+// names lists the names of files, in archive order.
+func names(files []*zip.File) []string {
+	var s []string
+	for _, f := range files {
+		s = append(s, f.Name)
+	}
+	return s
+}
+
+func TestMetaEntry(t *testing.T) {
+	// A metadata entry left by an earlier build is replaced, not kept
+	// twice, and the new one is written even though a filter matches it
+	src := makeZip(t, "", entry{"dinput8.dll", "x"}, entry{"openvr_api.dll", "x"}, entry{"meta.json", "old"})
+	fs, err := NewFilterSet([]string{"openvr", "meta"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		Prefix:   "MHWILDS",
+		MetaName: "meta.json",
+		MetaData: func(s Stats) ([]byte, error) { return []byte(strings.Repeat("r", s.Removed)), nil },
+	}
+	r, stats := transcode(t, src, &fs, opts)
+	want := []string{"MHWILDS/", "MHWILDS/dinput8.dll", "MHWILDS/meta.json"}
+	if got := names(r.File); !slices.Equal(got, want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	if stats.Kept != 1 || stats.Removed != 1 {
+		t.Errorf("stats = %+v, want 1 kept and 1 removed", stats)
+	}
+	rc, err := r.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "r" {
+		t.Errorf("metadata = %q, want it written from the final Stats", data)
+	}
+}
+
+func TestComment(t *testing.T) {
+	entries := []entry{{"dinput8.dll", "x"}}
+	r, _ := transcode(t, makeZip(t, "nightly-01233", entries...), nil, Options{})
+	if r.Comment != "nightly-01233" {
+		t.Errorf("kept comment = %q, want the source's", r.Comment)
+	}
+	r, _ = transcode(t, makeZip(t, "nightly-01233", entries...), nil, Options{Comment: "Built by test"})
+	if r.Comment != "Built by test" {
+		t.Errorf("comment = %q, want the one from Options", r.Comment)
+	}
+}
+
+func TestSourceRoot(t *testing.T) {
+	want := []string{"MHWILDS/", "MHWILDS/dinput8.dll", "MHWILDS/reframework/plugins/a.lua"}
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"flat", []entry{{"dinput8.dll", "x"}, {"reframework/plugins/a.lua", "x"}}},
+		{"prefixed", []entry{{"MHWILDS/", ""}, {"MHWILDS/dinput8.dll", "x"}, {"MHWILDS/reframework/plugins/a.lua", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, stats := transcode(t, makeZip(t, "", tt.entries...), nil, Options{Prefix: "MHWILDS", SourceRoot: "MHWILDS/"})
+			if got := names(r.File); !slices.Equal(got, want) {
+				t.Errorf("entries = %q, want %q", got, want)
+			}
+			if stats.Kept != 2 {
+				t.Errorf("Kept = %d, want 2", stats.Kept)
+			}
+		})
+	}
+}
+
+func TestSourceRootPartial(t *testing.T) {
+	// Only some entries under the root: nothing is stripped
+	files := []*zip.File{{FileHeader: zip.FileHeader{Name: "MHWILDS/a"}}, {FileHeader: zip.FileHeader{Name: "b"}}}
+	if got := SourceRoot(files, "MHWILDS/"); got != "" {
+		t.Errorf("SourceRoot = %q, want \"\"", got)
+	}
+	if got := SourceRoot(files[:1], ""); got != "" {
+		t.Errorf("SourceRoot with no dir = %q, want \"\"", got)
+	}
+}
+
+func TestCRCMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	body := []byte("dinput8 contents")
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "dinput8.dll",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(body) + 1,
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: uint64(len(body)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(body)
+	zw.Close()
+	src := bytes.NewReader(buf.Bytes())
+
+	_, err = TranscodeStream(context.Background(), src, src.Size(), io.Discard, nil, Options{})
+	if !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("err = %v, want zip.ErrChecksum", err)
+	}
+	if !strings.Contains(err.Error(), "dinput8.dll") {
+		t.Errorf("error %q does not name the entry", err)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	src := makeZip(t, "", entry{"dinput8.dll", "x"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := TranscodeStream(ctx, src, src.Size(), io.Discard, nil, Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestBackslashNames(t *testing.T) {
+	src := makeZip(t, "", entry{`dinput8.dll`, "x"}, entry{`reframework\plugins\a.lua`, "x"}, entry{`reframework\plugins\vr.lua`, "x"})
+	fs, err := NewFilterSet([]string{"plugins/vr"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, stats := transcode(t, src, &fs, Options{Prefix: "MHWILDS"})
+	want := []string{"MHWILDS/", "MHWILDS/dinput8.dll", "MHWILDS/reframework/plugins/a.lua"}
+	if got := names(r.File); !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if stats.Removed != 1 {
+		t.Errorf("Removed = %d, want 1", stats.Removed)
+	}
+}
+
+func TestEmptyDirectories(t *testing.T) {
+	entries := []entry{{"dinput8.dll", "x"}, {"reframework/data/", ""}}
+	t.Run("zip", func(t *testing.T) {
+		r, _ := transcode(t, makeZip(t, "", entries...), nil, Options{Prefix: "MHWILDS"})
+		for _, f := range r.File {
+			if f.Name == "MHWILDS/reframework/data/" {
+				if !f.Mode().IsDir() {
+					t.Errorf("mode = %v, want a directory", f.Mode())
+				}
+				return
+			}
+		}
+		t.Errorf("entries = %q, no empty directory", names(r.File))
+	})
+	t.Run("tgz", func(t *testing.T) {
+		src := makeZip(t, "", entries...)
+		zr, err := zip.NewReader(src, src.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if _, err := TarGz(context.Background(), zr, &out, nil, Options{Prefix: "MHWILDS"}); err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				t.Fatal("no empty directory in the tarball")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Name == "MHWILDS/reframework/data/" {
+				if hdr.Typeflag != tar.TypeDir {
+					t.Errorf("type = %c, want a directory", hdr.Typeflag)
+				}
+				return
+			}
+		}
+	})
+}
+
+func TestSymlinkDropped(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	hdr := &zip.FileHeader{Name: "reframework/passwd.dll"}
+	hdr.SetMode(os.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "/etc/passwd")
+	w, _ = zw.Create("dinput8.dll")
+	io.WriteString(w, "x")
+	zw.Close()
+	src := bytes.NewReader(buf.Bytes())
+
+	var warnings []string
+	opts := Options{Prefix: "MHWILDS", Warnf: func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}}
+	r, stats := transcode(t, src, nil, opts)
+	want := []string{"MHWILDS/", "MHWILDS/dinput8.dll"}
+	if got := names(r.File); !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if stats.Kept != 1 {
+		t.Errorf("Kept = %d, want 1", stats.Kept)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "reframework/passwd.dll") {
+		t.Errorf("warnings = %q, want one naming the symlink", warnings)
+	}
+}
+
+// logReporter keeps the lines logged to it.
+type logReporter struct {
+	report.NopReporter
+	lines []string
+}
+
+func (r *logReporter) Log(msg string) { r.lines = append(r.lines, msg) }
+
+func TestDuplicateEntry(t *testing.T) {
+	src := makeZip(t, "", entry{"foo.dll", "first"}, entry{"foo.dll", "second"})
+	rep := &logReporter{}
+	r, stats := transcode(t, src, nil, Options{Reporter: rep})
+	if got := names(r.File); !slices.Equal(got, []string{"foo.dll"}) {
+		t.Fatalf("entries = %q, want one foo.dll", got)
+	}
+	if stats.Kept != 1 {
+		t.Errorf("Kept = %d, want 1", stats.Kept)
+	}
+	rc, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "first" {
+		t.Errorf("foo.dll = %q, want the first entry's %q", body, "first")
+	}
+	want := []string{"Warning: skipping duplicate entry foo.dll"}
+	if !slices.Equal(rep.lines, want) {
+		t.Errorf("logged %q, want %q", rep.lines, want)
+	}
+}
+
+func BenchmarkTranscodeStream(b *testing.B) {
+	// A release-sized tree: many small scripts and a few large DLLs, with
+	// compressible but not trivial contents
+	var entries []entry
+	line := "local re = require(\"reframework\") -- padding to look like a script\n"
+	for i := range 200 {
+		entries = append(entries, entry{fmt.Sprintf("reframework/autorun/script%03d.lua", i), strings.Repeat(line, 64)})
+	}
+	for i := range 4 {
+		body := make([]byte, 4<<20)
+		for j := range body {
+			body[j] = byte(j*7 + j>>9 + i)
+		}
+		entries = append(entries, entry{fmt.Sprintf("reframework/plugins/plugin%d.dll", i), string(body)})
+	}
+	src := makeZip(b, "", entries...)
+	var size int64
+	for _, e := range entries {
+		size += int64(len(e.body))
+	}
+
+	b.SetBytes(size) // throughput of the uncompressed contents
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := TranscodeStream(context.Background(), src, src.Size(), io.Discard, nil, Options{Prefix: "MHWILDS"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPackDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"c.txt", "b.txt", "b/z.txt", "Z.txt", "a.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "b", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Not every platform lets a test make symlinks
+	linked := os.Symlink("/etc/passwd", filepath.Join(dir, "link.txt")) == nil
+
+	var warnings []string
+	warnf := func(format string, args ...any) { warnings = append(warnings, fmt.Sprintf(format, args...)) }
+	dest := filepath.Join(t.TempDir(), "packed.zip")
+	if err := PackDir(context.Background(), dir, dest, warnf); err != nil {
+		t.Fatal(err)
+	}
+	if linked && (len(warnings) != 1 || !strings.Contains(warnings[0], "link.txt")) {
+		t.Errorf("warnings = %q, want one naming link.txt", warnings)
+	}
+	r, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Lexical within each folder, and a folder's contents right after it
+	// (so b/ and all of it before b.txt)
+	want := []string{"Z.txt", "a.txt", "b/", "b/empty/", "b/z.txt", "b.txt", "c.txt"}
+	if got := names(r.File); !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	for _, f := range r.File {
+		if f.Method != zip.Store {
+			t.Errorf("%s: method %d, want Store", f.Name, f.Method)
+		}
+	}
+}
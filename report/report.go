@@ -0,0 +1,122 @@
+// Package report decouples the build steps from the front end that shows
+// their progress. The steps talk to a Reporter; the CLIs pass a Terminal,
+// the GUI its own window-backed implementation, and library callers a
+// NopReporter.
+package report
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Reporter receives what a build step is doing. Implementations must be
+// safe to call from any goroutine.
+type Reporter interface {
+	Status(msg string)     // what the step is doing now
+	Progress(frac float64) // how far along it is, 0 to 1
+	Log(msg string)        // a line worth keeping, such as a warning
+}
+
+// EntryReporter is a Reporter that also shows which archive entry is being
+// processed. Steps that work entry by entry call Entry before each
+// Progress when their Reporter has it.
+type EntryReporter interface {
+	Reporter
+	Entry(name string)
+}
+
+// LineReporter is a Reporter that draws progress on a line of its own.
+// EndLine finishes that line, for steps that stop before reaching 1 or
+// whose caller prints next.
+type LineReporter interface {
+	Reporter
+	EndLine()
+}
+
+// NopReporter discards everything.
+type NopReporter struct{}
+
+func (NopReporter) Status(string)    {}
+func (NopReporter) Progress(float64) {}
+func (NopReporter) Log(string)       {}
+
+// Terminal prints to stdout: Status and Log as lines, Progress as a bar
+// redrawn in place on a line of its own. Quiet drops Status and Progress
+// but keeps Log.
+type Terminal struct {
+	Quiet bool
+
+	mu   sync.Mutex
+	open bool // a progress line is on screen without its newline
+	pct  int  // percentage last drawn on it
+}
+
+// Status prints msg on its own line.
+func (t *Terminal) Status(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endLine()
+	if !t.Quiet {
+		fmt.Println(msg)
+	}
+}
+
+// Log prints msg on its own line, even when Quiet.
+func (t *Terminal) Log(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endLine()
+	fmt.Println(msg)
+}
+
+// Progress redraws the bar when the whole percentage changes, and ends its
+// line once frac reaches 1.
+func (t *Terminal) Progress(frac float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Quiet {
+		return
+	}
+	frac = min(max(frac, 0), 1)
+	pct := int(frac * 100)
+	if !t.open || pct != t.pct {
+		filled := int(frac * 30)
+		fmt.Printf("\r    [%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(".", 30-filled), pct)
+		t.open, t.pct = true, pct
+	}
+	if frac == 1 {
+		t.endLine()
+	}
+}
+
+// EndLine finishes an open progress line so the next output starts on a
+// fresh one.
+func (t *Terminal) EndLine() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.endLine()
+}
+
+func (t *Terminal) endLine() {
+	if t.open {
+		fmt.Println()
+		t.open = false
+	}
+}
+
+// EndLine finishes r's progress line if r is a LineReporter.
+func EndLine(r Reporter) {
+	if lr, ok := r.(LineReporter); ok {
+		lr.EndLine()
+	}
+}
+
+// EntryProgress tells r that the archive entry name is being processed and
+// frac of the work is done, calling Entry first if r has it.
+func EntryProgress(r Reporter, name string, frac float64) {
+	if er, ok := r.(EntryReporter); ok {
+		er.Entry(name)
+	}
+	r.Progress(frac)
+}
@@ -0,0 +1,66 @@
+// Package stamp keeps the <archive>.source.json files that record what an
+// archive was built from, so a rebuild from an unchanged source can be
+// skipped.
+package stamp
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Stamp records the source and options an archive was built with.
+type Stamp struct {
+	Tag       string    `json:"tag"`
+	Asset     string    `json:"asset"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Filters   string    `json:"filters"`
+
+	// The options that shape the archive without changing its name
+	Prefix     string    `json:"prefix"`
+	Comment    string    `json:"comment,omitempty"`
+	EntryTime  time.Time `json:"entryTime,omitzero"`
+	NoMetadata bool      `json:"noMetadata,omitempty"`
+}
+
+// Path is where the stamp of archive is saved.
+func Path(archive string) string {
+	return archive + ".source.json"
+}
+
+// Equal reports whether s and o describe the same asset (by digest, size
+// and upload time) built with the same filters and output options.
+func (s Stamp) Equal(o Stamp) bool {
+	return s.Tag == o.Tag && s.Asset == o.Asset && s.Size == o.Size &&
+		s.Digest == o.Digest && s.UpdatedAt.Equal(o.UpdatedAt) && s.Filters == o.Filters &&
+		s.Prefix == o.Prefix && s.Comment == o.Comment && s.EntryTime.Equal(o.EntryTime) && s.NoMetadata == o.NoMetadata
+}
+
+// Read loads the stamp saved beside archive.
+func Read(archive string) (Stamp, error) {
+	var s Stamp
+	data, err := os.ReadFile(Path(archive))
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// Unchanged reports whether archive has a stamp equal to want. A missing or
+// unreadable stamp counts as changed.
+func Unchanged(archive string, want Stamp) bool {
+	got, err := Read(archive)
+	return err == nil && got.Equal(want)
+}
+
+// Write saves s beside archive.
+func Write(archive string, s Stamp) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(Path(archive), data, 0644)
+}
@@ -0,0 +1,38 @@
+// Package termcolor wraps status text in ANSI colors when stdout is a
+// terminal that can show them.
+package termcolor
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	once    sync.Once
+	enabled bool
+)
+
+// Enabled reports whether colors should be written to stdout: it is a
+// terminal, NO_COLOR is unset, and (on Windows) virtual-terminal processing
+// could be switched on. The answer is worked out once.
+func Enabled() bool {
+	once.Do(func() {
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return
+		}
+		fi, err := os.Stdout.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return
+		}
+		enabled = enableVT()
+	})
+	return enabled
+}
+
+// BoldBlue returns s in bold blue, or unchanged when colors are off.
+func BoldBlue(s string) string {
+	if !Enabled() {
+		return s
+	}
+	return "\033[1;34m" + s + "\033[0m"
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package termcolor
+
+// enableVT is a no-op: other terminals handle ANSI escapes natively.
+func enableVT() bool {
+	return true
+}
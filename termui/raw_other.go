@@ -0,0 +1,13 @@
+//go:build !linux
+
+package termui
+
+// makeRaw is not implemented here; Select returns ErrUnsupported.
+func makeRaw(fd int) (func(), error) {
+	return nil, ErrUnsupported
+}
+
+// size returns the usual 80x24.
+func size(fd int) (int, int) {
+	return 80, 24
+}
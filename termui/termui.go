@@ -0,0 +1,207 @@
+// Package termui is a minimal full-screen terminal menu: an arrow-key list
+// with a detail panel beside it, drawn with ANSI escapes. It needs a real
+// terminal on stdin and stdout; callers fall back to plain prompts when
+// Available reports false or Select fails.
+package termui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned by Select where raw terminal input isn't
+// implemented.
+var ErrUnsupported = errors.New("terminal UI is not supported on this platform")
+
+// Item is one row of a Select list.
+type Item struct {
+	Label  string
+	Detail []string // shown beside the list while the row is highlighted
+	// Disabled, if set, is why the row can't be chosen; Enter shows it
+	// instead of returning.
+	Disabled string
+}
+
+// Available reports whether stdin and stdout are both terminals.
+func Available() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		fi, err := f.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// active undoes what the running Select did to the terminal, or is nil.
+var (
+	activeMu sync.Mutex
+	active   func()
+)
+
+func setActive(restore func()) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active = restore
+}
+
+// Restore puts the terminal back the way Select found it if a Select is
+// running. A program that exits from another goroutine, such as a signal
+// handler or a timer, calls it first, since os.Exit skips Select's own
+// deferred restore. Otherwise it does nothing.
+func Restore() {
+	activeMu.Lock()
+	restore := active
+	activeMu.Unlock()
+	if restore != nil {
+		restore()
+	}
+}
+
+// Select shows items under title and lets the user move with the arrow
+// keys (or j/k, PgUp/PgDn, Home/End) and choose with Enter. It returns the
+// chosen index, or -1 if the user quit with q, Esc or Ctrl-C. The screen is
+// restored before it returns.
+func Select(title string, items []Item, start int) (int, error) {
+	if len(items) == 0 {
+		return -1, errors.New("nothing to choose from")
+	}
+	restoreMode, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return -1, err
+	}
+	// Alternate screen, hidden cursor; undone in the reverse order on return
+	fmt.Print("\033[?1049h\033[?25l")
+	restore := sync.OnceFunc(func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		restoreMode()
+	})
+	setActive(restore)
+	defer setActive(nil)
+	defer restore()
+
+	cur := min(max(start, 0), len(items)-1)
+	top, status := 0, ""
+	buf := make([]byte, 16)
+	for {
+		width, height := size(int(os.Stdout.Fd()))
+		rows := max(height-4, 1)
+		if cur < top {
+			top = cur
+		} else if cur >= top+rows {
+			top = cur - rows + 1
+		}
+		draw(title, items, cur, top, rows, width, status)
+		status = ""
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return -1, err
+		}
+		switch key := string(buf[:n]); key {
+		case "\033[A", "\033OA", "k":
+			cur = max(cur-1, 0)
+		case "\033[B", "\033OB", "j":
+			cur = min(cur+1, len(items)-1)
+		case "\033[5~":
+			cur = max(cur-rows, 0)
+		case "\033[6~":
+			cur = min(cur+rows, len(items)-1)
+		case "\033[H", "\033OH", "\033[1~", "g":
+			cur = 0
+		case "\033[F", "\033OF", "\033[4~", "G":
+			cur = len(items) - 1
+		case "\r", "\n":
+			if items[cur].Disabled != "" {
+				status = items[cur].Disabled
+				continue
+			}
+			return cur, nil
+		case "q", "\033", "\x03":
+			return -1, nil
+		}
+	}
+}
+
+// draw repaints the whole screen: title, the visible rows of the list with
+// cur highlighted, the detail panel for cur, and a footer.
+func draw(title string, items []Item, cur, top, rows, width int, status string) {
+	listWidth := 0
+	for _, it := range items {
+		listWidth = max(listWidth, utf8.RuneCountInString(it.Label)+4)
+	}
+	listWidth = min(listWidth, width/2)
+	panelWidth := width - listWidth - 3
+
+	var detail []string
+	for _, line := range items[cur].Detail {
+		detail = append(detail, wrap(line, panelWidth)...)
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "\033[1m%s\033[0m\r\n\r\n", clip(title, width))
+	for i := 0; i < rows; i++ {
+		row := strings.Repeat(" ", listWidth)
+		if idx := top + i; idx < len(items) {
+			row = pad("  "+items[idx].Label, listWidth)
+			if idx == cur {
+				row = "\033[7m" + pad("> "+items[idx].Label, listWidth) + "\033[0m"
+			}
+		}
+		b.WriteString(row)
+		if panelWidth > 0 && i < len(detail) {
+			b.WriteString(" | " + detail[i])
+		}
+		b.WriteString("\r\n")
+	}
+	footer := fmt.Sprintf("%d/%d  Up/Down move, Enter builds, q quits", cur+1, len(items))
+	if status != "" {
+		footer = status
+	}
+	b.WriteString("\r\n" + clip(footer, width))
+	fmt.Print(b.String())
+}
+
+// Bar draws a text progress bar width cells wide for frac (0 to 1).
+func Bar(frac float64, width int) string {
+	filled := int(min(max(frac, 0), 1) * float64(width))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+// wrap splits s into lines of at most width runes, breaking at spaces
+// where it can.
+func wrap(s string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for utf8.RuneCountInString(s) > width {
+		r := []rune(s)
+		cut := strings.LastIndex(string(r[:width+1]), " ")
+		if cut <= 0 {
+			cut = len(string(r[:width]))
+		}
+		lines = append(lines, strings.TrimRight(s[:cut], " "))
+		s = strings.TrimLeft(s[cut:], " ")
+	}
+	return append(lines, s)
+}
+
+// clip shortens s to width runes.
+func clip(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:max(width, 0)])
+	}
+	return s
+}
+
+// pad clips or space-pads s to exactly width runes.
+func pad(s string, width int) string {
+	s = clip(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
@@ -0,0 +1,79 @@
+// Package workdir creates the temp dirs builds work in, and sweeps the ones
+// that builds which crashed or were killed left behind.
+package workdir
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix starts the name of every work dir.
+const Prefix = "reframework-"
+
+// ownerFile holds the pid of the process using a work dir, so a sweep by
+// another instance leaves it alone however long the build takes.
+const ownerFile = ".owner"
+
+// Create makes a new work dir named reframework-<kind>-* in the temp root
+// and records this process as its owner.
+func Create(kind string) (string, error) {
+	dir, err := os.MkdirTemp("", Prefix+kind+"-*")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ownerFile), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// inUse reports whether the process that created dir is still running.
+// Dirs without an owner file predate it and count as abandoned.
+func inUse(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, ownerFile))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return pid == os.Getpid() || running(pid)
+}
+
+// Sweep removes work dirs older than maxAge whose owner is no longer
+// running, from the temp root and, where there is one, /dev/shm. It
+// returns the number of dirs removed and the bytes reclaimed.
+func Sweep(maxAge time.Duration) (int, uint64) {
+	removed := 0
+	var reclaimed uint64
+	cutoff := time.Now().Add(-maxAge)
+	for _, root := range roots() {
+		matches, _ := filepath.Glob(filepath.Join(root, Prefix+"*"))
+		for _, dir := range matches {
+			fi, err := os.Lstat(dir)
+			if err != nil || !fi.IsDir() || fi.ModTime().After(cutoff) || inUse(dir) {
+				continue
+			}
+			var size uint64
+			filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					if info, err := d.Info(); err == nil {
+						size += uint64(info.Size())
+					}
+				}
+				return nil
+			})
+			if os.RemoveAll(dir) == nil {
+				removed++
+				reclaimed += size
+			}
+		}
+	}
+	return removed, reclaimed
+}
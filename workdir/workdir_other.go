@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package workdir
+
+import "os"
+
+// roots are where work dirs are looked for: the temp root.
+func roots() []string {
+	return []string{os.TempDir()}
+}
+
+// running can't tell here, so every owned work dir counts as in use.
+func running(int) bool {
+	return true
+}
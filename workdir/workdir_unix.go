@@ -0,0 +1,21 @@
+//go:build unix
+
+package workdir
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// roots are where work dirs are looked for: the temp root, and /dev/shm,
+// which some setups point TMPDIR at for speed.
+func roots() []string {
+	return []string{os.TempDir(), "/dev/shm"}
+}
+
+// running reports whether a process with the given pid exists.
+func running(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
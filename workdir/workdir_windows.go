@@ -0,0 +1,28 @@
+package workdir
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// roots are where work dirs are looked for: the temp root.
+func roots() []string {
+	return []string{os.TempDir()}
+}
+
+// running reports whether a process with the given pid exists and hasn't
+// exited yet.
+func running(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	return windows.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// stillActive is the exit code GetExitCodeProcess reports for a process
+// that is still running (STILL_ACTIVE).
+const stillActive = 259